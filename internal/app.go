@@ -9,22 +9,27 @@ import (
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/goverland-labs/goverland-analytics-api-protocol/protobuf/internalapi"
 	"github.com/goverland-labs/goverland-platform-events/events/core"
 	"github.com/goverland-labs/goverland-platform-events/pkg/natsclient"
 	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
 	"github.com/s-larionov/process-manager"
+	"google.golang.org/grpc"
 	gormCh "gorm.io/driver/clickhouse"
 	"gorm.io/gorm"
 
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/dao"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/delegation"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/item"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/migration"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/proposal"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/storage"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/token"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/vote"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/cache"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/grpcsrv"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/health"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/pprofhandler"
@@ -33,18 +38,30 @@ import (
 
 type Application struct {
 	sigChan <-chan os.Signal
-	manager *process.Manager
 	cfg     config.App
 	db      *gorm.DB
 
-	natsPublisher    *natsclient.Publisher
-	repo             *item.Repo
-	service          *item.Service
-	clickhouseConn   *sql.DB
-	tokensStorage    *storage.ClickhouseWorker[*core.TokenPricePayload]
-	votesStorage     *storage.ClickhouseWorker[*core.VotePayload]
-	proposalsStorage *storage.ClickhouseWorker[proposal.Payload]
-	daosStorage      *storage.ClickhouseWorker[dao.Payload]
+	// workers are split by shutdown stages: consumers are stopped first to drain delivered messages
+	// into the storage workers, then storage workers flush batches, then the rest is stopped
+	consumers *process.Manager
+	storages  *process.Manager
+	manager   *process.Manager
+
+	natsConn           *nats.Conn
+	natsPublisher      *natsclient.Publisher
+	repo               *item.Repo
+	service            *item.Service
+	cache              *cache.Cache
+	cachedProvider     *item.CachedProvider
+	totalsWatcher      *item.TotalsWatcher
+	clickhouseConn     *sql.DB
+	clickhouseNative   driver.Conn
+	tokensStorage      *storage.ClickhouseWorker[*core.TokenPricePayload]
+	votesStorage       *storage.ClickhouseWorker[*core.VotePayload]
+	proposalsStorage   *storage.ClickhouseWorker[proposal.Payload]
+	daosStorage        *storage.ClickhouseWorker[dao.Payload]
+	delegationsStorage *storage.ClickhouseWorker[delegation.Payload]
+	storageOpts        []storage.Option
 }
 
 func NewApplication(cfg config.App) (*Application, error) {
@@ -52,9 +69,11 @@ func NewApplication(cfg config.App) (*Application, error) {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	a := &Application{
-		sigChan: sigChan,
-		cfg:     cfg,
-		manager: process.NewManager(),
+		sigChan:   sigChan,
+		cfg:       cfg,
+		consumers: process.NewManager(),
+		storages:  process.NewManager(),
+		manager:   process.NewManager(),
 	}
 
 	err := a.bootstrap()
@@ -66,6 +85,8 @@ func NewApplication(cfg config.App) (*Application, error) {
 }
 
 func (a *Application) Run() {
+	a.storages.StartAll()
+	a.consumers.StartAll()
 	a.manager.StartAll()
 	a.registerShutdown()
 }
@@ -76,22 +97,27 @@ func (a *Application) bootstrap() error {
 		a.initClickhouse,
 		a.initNats,
 		a.initServices,
+		a.initStorageOptions,
 
 		// Init Workers: Clickhouse Storage Workers (should be before consumers!!!)
 		a.initDaosStorageWorker,
 		a.initProposalsStorageWorker,
 		a.initVotesStorageWorker,
 		a.initTokensStorageWorker,
+		a.initDelegationsStorageWorker,
 
 		// Init Workers: Consumers
 		a.initDaosConsumerWorker,
 		a.initProposalsConsumerWorker,
 		a.initVotesConsumerWorker,
 		a.initTokensConsumerWorker,
+		a.initDelegationsConsumerWorker,
 
 		// Init Workers: Application
+		a.initTotalsWatcherWorker,
 		a.initGRPCWorker,
 		a.initPopularityIndexWorker,
+		a.initCacheWorker,
 
 		// Init Workers: System
 		a.initPrometheusWorker,
@@ -109,7 +135,22 @@ func (a *Application) bootstrap() error {
 }
 
 func (a *Application) initClickhouse() error {
-	a.clickhouseConn = clickhouse.OpenDB(&clickhouse.Options{
+	if err := a.openClickhouse(); err != nil {
+		return err
+	}
+
+	if err := migration.ApplyMigrations(a.db, migration.GetAllMigrations()); err != nil {
+		return err
+	}
+
+	a.repo = item.NewRepo(a.db)
+
+	return nil
+}
+
+// openClickhouse opens connections without applying migrations
+func (a *Application) openClickhouse() error {
+	opts := &clickhouse.Options{
 		Addr: []string{a.cfg.ClickHouse.Host},
 		Auth: clickhouse.Auth{
 			Database: a.cfg.ClickHouse.DB,
@@ -117,22 +158,25 @@ func (a *Application) initClickhouse() error {
 			Password: a.cfg.ClickHouse.Password,
 		},
 		Debug: a.cfg.ClickHouse.Debug,
-	})
+	}
+	a.clickhouseConn = clickhouse.OpenDB(opts)
 
-	db, err := gorm.Open(gormCh.New(gormCh.Config{Conn: a.clickhouseConn}), &gorm.Config{})
-	if err != nil {
-		return err
+	if a.cfg.Storage.Daos.NativeBatch || a.cfg.Storage.Proposals.NativeBatch || a.cfg.Storage.Votes.NativeBatch || a.cfg.Storage.Tokens.NativeBatch ||
+		a.cfg.Storage.Delegations.NativeBatch {
+		conn, err := clickhouse.Open(opts)
+		if err != nil {
+			return fmt.Errorf("clickhouse native conn: %w", err)
+		}
+		a.clickhouseNative = conn
 	}
 
-	err = migration.ApplyMigrations(db, migration.GetAllMigrations())
+	db, err := gorm.Open(gormCh.New(gormCh.Config{Conn: a.clickhouseConn}), &gorm.Config{})
 	if err != nil {
 		return err
 	}
-
 	a.db = db
-	a.repo = item.NewRepo(a.db)
 
-	return err
+	return nil
 }
 
 func (a *Application) initNats() error {
@@ -150,6 +194,7 @@ func (a *Application) initNats() error {
 	if err != nil {
 		return err
 	}
+	a.natsConn = conn
 	a.natsPublisher = pb
 
 	return nil
@@ -170,7 +215,19 @@ func (a *Application) createNatsConnection() (*nats.Conn, error) {
 }
 
 func (a *Application) initServices() error {
-	service, err := item.NewService(a.natsPublisher, a.repo)
+	var dp item.DataProvider = a.repo
+	if a.cfg.Cache.Enabled {
+		methodTTLs, err := a.cfg.Cache.ParseMethodTTLs()
+		if err != nil {
+			return fmt.Errorf("cache config: %w", err)
+		}
+
+		a.cache = cache.New(a.cfg.Cache.MaxEntries)
+		a.cachedProvider = item.NewCachedProvider(a.repo, a.cache, a.cfg.Cache.DaoTTL, a.cfg.Cache.EcosystemTTL, methodTTLs)
+		dp = a.cachedProvider
+	}
+
+	service, err := item.NewService(a.natsPublisher, dp)
 	if err != nil {
 		return fmt.Errorf("service: %w", err)
 	}
@@ -179,10 +236,65 @@ func (a *Application) initServices() error {
 	return nil
 }
 
+func (a *Application) initStorageOptions() error {
+	if err := a.cfg.Storage.Validate(); err != nil {
+		return fmt.Errorf("storage config: %w", err)
+	}
+
+	a.storageOpts = []storage.Option{
+		storage.WithRetryPolicy(storage.RetryPolicy{
+			MaxAttempts:    a.cfg.Storage.CommitRetryAttempts,
+			InitialBackoff: a.cfg.Storage.CommitRetryBackoff,
+			MaxBackoff:     a.cfg.Storage.CommitRetryMaxBackoff,
+		}),
+	}
+
+	if a.cfg.Storage.WALEnabled {
+		a.storageOpts = append(a.storageOpts, storage.WithWAL(a.cfg.Storage.WALDir, a.cfg.Storage.WALSyncInterval))
+	}
+
+	switch a.cfg.Storage.DeadLetterSink {
+	case config.DeadLetterSinkNone:
+	case config.DeadLetterSinkFile:
+		sink, err := storage.NewFileSink(a.cfg.Storage.DeadLetterDir)
+		if err != nil {
+			return fmt.Errorf("dead letter sink: %w", err)
+		}
+		a.storageOpts = append(a.storageOpts, storage.WithDeadLetterSink(sink))
+	case config.DeadLetterSinkNats:
+		a.storageOpts = append(a.storageOpts, storage.WithDeadLetterSink(storage.NewNatsSink(a.natsPublisher, a.cfg.Storage.DeadLetterSubject, a.natsConn.MaxPayload)))
+	}
+
+	return nil
+}
+
+func (a *Application) storageBackend(cfg config.StorageWorker) storage.Backend {
+	if cfg.NativeBatch {
+		return storage.NewNativeBackend(a.clickhouseNative)
+	}
+
+	return storage.NewSQLBackend(a.clickhouseConn)
+}
+
+func newClickhouseWorker[T any](a *Application, source string, adapter storage.Adapter[T], cfg config.StorageWorker) *storage.ClickhouseWorker[T] {
+	opts := append([]storage.Option{
+		storage.WithChannelCapacity(cfg.ChannelCapacity),
+		storage.WithInsertConcurrency(cfg.InsertConcurrency),
+	}, a.storageOpts...)
+	if cfg.Adaptive {
+		opts = append(opts, storage.WithAdaptiveBatching(storage.AdaptivePolicy{
+			MinBatchSize:        cfg.MinBatchSize,
+			MinBatchDuration:    cfg.MinBatchDuration,
+			TargetCommitLatency: cfg.TargetCommitLatency,
+		}))
+	}
+
+	return storage.NewClickhouseWorker[T](source, a.storageBackend(cfg), adapter, cfg.MaxBatchSize, cfg.MaxBatchDuration, opts...)
+}
+
 func (a *Application) initDaosStorageWorker() error {
-	// TODO: Move parameters to the config
-	a.daosStorage = storage.NewClickhouseWorker[dao.Payload]("daos", a.clickhouseConn, dao.ClickhouseAdapter{}, 1000, 5*time.Minute)
-	a.manager.AddWorker(process.NewCallbackWorker("daos ch storage", a.daosStorage.Start))
+	a.daosStorage = newClickhouseWorker[dao.Payload](a, "daos", dao.ClickhouseAdapter{}, a.cfg.Storage.Daos)
+	a.storages.AddWorker(process.NewCallbackWorker("daos ch storage", a.daosStorage.Start))
 
 	return nil
 }
@@ -194,15 +306,14 @@ func (a *Application) initDaosConsumerWorker() error {
 	}
 
 	worker := dao.NewConsumer(conn, a.daosStorage)
-	a.manager.AddWorker(process.NewCallbackWorker("daos consumer", worker.Start))
+	a.consumers.AddWorker(process.NewCallbackWorker("daos consumer", worker.Start))
 
 	return nil
 }
 
 func (a *Application) initProposalsStorageWorker() error {
-	// TODO: Move parameters to the config
-	a.proposalsStorage = storage.NewClickhouseWorker[proposal.Payload]("proposals", a.clickhouseConn, proposal.ClickhouseAdapter{}, 1000, 5*time.Minute)
-	a.manager.AddWorker(process.NewCallbackWorker("proposals ch storage", a.proposalsStorage.Start))
+	a.proposalsStorage = newClickhouseWorker[proposal.Payload](a, "proposals", proposal.ClickhouseAdapter{}, a.cfg.Storage.Proposals)
+	a.storages.AddWorker(process.NewCallbackWorker("proposals ch storage", a.proposalsStorage.Start))
 
 	return nil
 }
@@ -214,15 +325,14 @@ func (a *Application) initProposalsConsumerWorker() error {
 	}
 
 	worker := proposal.NewConsumer(conn, a.proposalsStorage)
-	a.manager.AddWorker(process.NewCallbackWorker("proposals consumer", worker.Start))
+	a.consumers.AddWorker(process.NewCallbackWorker("proposals consumer", worker.Start))
 
 	return nil
 }
 
 func (a *Application) initVotesStorageWorker() error {
-	// TODO: Move parameters to the config
-	a.votesStorage = storage.NewClickhouseWorker[*core.VotePayload]("votes", a.clickhouseConn, vote.ClickhouseAdapter{}, 50000, 5*time.Minute)
-	a.manager.AddWorker(process.NewCallbackWorker("votes ch storage", a.votesStorage.Start))
+	a.votesStorage = newClickhouseWorker[*core.VotePayload](a, "votes", vote.ClickhouseAdapter{}, a.cfg.Storage.Votes)
+	a.storages.AddWorker(process.NewCallbackWorker("votes ch storage", a.votesStorage.Start))
 
 	return nil
 }
@@ -234,14 +344,14 @@ func (a *Application) initVotesConsumerWorker() error {
 	}
 
 	worker := vote.NewConsumer(conn, a.votesStorage)
-	a.manager.AddWorker(process.NewCallbackWorker("votes consumer", worker.Start))
+	a.consumers.AddWorker(process.NewCallbackWorker("votes consumer", worker.Start))
 
 	return nil
 }
 
 func (a *Application) initTokensStorageWorker() error {
-	a.tokensStorage = storage.NewClickhouseWorker[*core.TokenPricePayload]("tokens", a.clickhouseConn, token.ClickhouseAdapter{}, 500, 5*time.Minute)
-	a.manager.AddWorker(process.NewCallbackWorker("tokens ch storage", a.tokensStorage.Start))
+	a.tokensStorage = newClickhouseWorker[*core.TokenPricePayload](a, "tokens", token.ClickhouseAdapter{}, a.cfg.Storage.Tokens)
+	a.storages.AddWorker(process.NewCallbackWorker("tokens ch storage", a.tokensStorage.Start))
 
 	return nil
 }
@@ -253,13 +363,42 @@ func (a *Application) initTokensConsumerWorker() error {
 	}
 
 	worker := token.NewConsumer(conn, a.tokensStorage)
-	a.manager.AddWorker(process.NewCallbackWorker("tokens consumer", worker.Start))
+	a.consumers.AddWorker(process.NewCallbackWorker("tokens consumer", worker.Start))
+
+	return nil
+}
+
+func (a *Application) initDelegationsStorageWorker() error {
+	a.delegationsStorage = newClickhouseWorker[delegation.Payload](a, "delegations", delegation.ClickhouseAdapter{}, a.cfg.Storage.Delegations)
+	a.storages.AddWorker(process.NewCallbackWorker("delegations ch storage", a.delegationsStorage.Start))
+
+	return nil
+}
+
+func (a *Application) initDelegationsConsumerWorker() error {
+	conn, err := a.createNatsConnection()
+	if err != nil {
+		return err
+	}
+
+	worker := delegation.NewConsumer(conn, a.delegationsStorage)
+	a.consumers.AddWorker(process.NewCallbackWorker("delegations consumer", worker.Start))
 
 	return nil
 }
 
 func (a *Application) initGRPCWorker() error {
-	srv := grpcsrv.NewGrpcServer()
+	timeouts, err := a.cfg.InternalAPI.ParseMethodTimeouts()
+	if err != nil {
+		return fmt.Errorf("internal api config: %w", err)
+	}
+
+	srv := grpcsrv.NewGrpcServer(
+		grpc.ChainUnaryInterceptor(
+			grpcsrv.UnaryTimeout(a.cfg.InternalAPI.RequestTimeout, timeouts),
+			item.UnaryErrorInterceptor(),
+		),
+	)
 	internalapi.RegisterAnalyticsServer(srv, item.NewServer(a.service))
 
 	a.manager.AddWorker(grpcsrv.NewGrpcServerWorker("gRPC server", srv, a.cfg.InternalAPI.Bind))
@@ -275,6 +414,31 @@ func (a *Application) initPopularityIndexWorker() error {
 	return nil
 }
 
+func (a *Application) initTotalsWatcherWorker() error {
+	a.totalsWatcher = item.NewTotalsWatcher(a.service)
+	a.daosStorage.RegisterCallback(a.totalsWatcher.OnCommit)
+	a.proposalsStorage.RegisterCallback(a.totalsWatcher.OnCommit)
+	a.votesStorage.RegisterCallback(a.totalsWatcher.OnCommit)
+	a.manager.AddWorker(process.NewCallbackWorker("ecosystem totals watcher", a.totalsWatcher.Process))
+
+	return nil
+}
+
+func (a *Application) initCacheWorker() error {
+	if a.cachedProvider == nil {
+		return nil
+	}
+
+	a.daosStorage.RegisterCallback(a.cachedProvider.OnCommit)
+	a.proposalsStorage.RegisterCallback(a.cachedProvider.OnCommit)
+	a.votesStorage.RegisterCallback(a.cachedProvider.OnCommit)
+	a.tokensStorage.RegisterCallback(a.cachedProvider.OnCommit)
+	a.delegationsStorage.RegisterCallback(a.cachedProvider.OnCommit)
+	a.manager.AddWorker(process.NewCallbackWorker("cache cleanup", a.cache.Process))
+
+	return nil
+}
+
 func (a *Application) initPrometheusWorker() error {
 	srv := prometheus.NewServer(a.cfg.Prometheus.Listen, "/metrics")
 	a.manager.AddWorker(process.NewServerWorker("prometheus", srv))
@@ -283,12 +447,28 @@ func (a *Application) initPrometheusWorker() error {
 }
 
 func (a *Application) initHealthWorker() error {
-	srv := health.NewHealthCheckServer(a.cfg.Health.Listen, "/status", health.DefaultHandler(a.manager))
+	checks := map[string]health.Check{
+		"daos_storage":        healthyStorage(a.daosStorage),
+		"proposals_storage":   healthyStorage(a.proposalsStorage),
+		"votes_storage":       healthyStorage(a.votesStorage),
+		"tokens_storage":      healthyStorage(a.tokensStorage),
+		"delegations_storage": healthyStorage(a.delegationsStorage),
+		"consumers":           a.consumers.IsRunning,
+		"storages":            a.storages.IsRunning,
+	}
+
+	srv := health.NewHealthCheckServer(a.cfg.Health.Listen, "/status", health.DefaultHandler(a.manager, checks))
 	a.manager.AddWorker(process.NewServerWorker("health", srv))
 
 	return nil
 }
 
+func healthyStorage(st interface{ IsDegraded() bool }) health.Check {
+	return func() bool {
+		return !st.IsDegraded()
+	}
+}
+
 func (a *Application) initPprofWorker() error {
 	if !a.cfg.Pprof.Enabled {
 		return nil
@@ -300,12 +480,79 @@ func (a *Application) initPprofWorker() error {
 	return nil
 }
 
+// registerShutdown waits for the signal or for any stage to stop by itself and stops stages in order
 func (a *Application) registerShutdown() {
-	go func(manager *process.Manager) {
-		<-a.sigChan
+	select {
+	case <-a.sigChan:
+	case <-awaitManager(a.consumers):
+	case <-awaitManager(a.storages):
+	case <-awaitManager(a.manager):
+	}
+
+	stages := []struct {
+		name    string
+		manager *process.Manager
+		timeout time.Duration
+		after   func()
+	}{
+		{name: "consumers", manager: a.consumers, timeout: a.cfg.Shutdown.ConsumersTimeout},
+		{name: "storages", manager: a.storages, timeout: a.cfg.Shutdown.StoragesTimeout, after: a.logUncommitted},
+		{name: "application", manager: a.manager, timeout: a.cfg.Shutdown.ApplicationTimeout},
+	}
+
+	deadline := time.Now().Add(a.cfg.Shutdown.Timeout)
+	for _, stage := range stages {
+		start := time.Now()
+		stage.manager.StopAll()
+
+		// the stage gets the rest of the total budget at most, so the whole shutdown fits it
+		stage.timeout = min(stage.timeout, max(time.Until(deadline), 0))
+		timer := time.NewTimer(stage.timeout)
+		select {
+		case <-awaitManager(stage.manager):
+			log.Info().Str("stage", stage.name).Dur("elapsed", time.Since(start)).Msg("shutdown stage is completed")
+		case <-timer.C:
+			log.Error().
+				Str("stage", stage.name).
+				Dur("timeout", stage.timeout).
+				Msg("shutdown stage timeout is exceeded, stage isn't completed")
+		}
+		timer.Stop()
+
+		if stage.after != nil {
+			stage.after()
+		}
+	}
+}
+
+// logUncommitted reports items dropped on shutdown. Acked by nats items are lost unless the wal is enabled,
+// items of not acked messages are redelivered.
+func (a *Application) logUncommitted() {
+	storages := map[string]interface{ Uncommitted() int64 }{
+		"daos":        a.daosStorage,
+		"proposals":   a.proposalsStorage,
+		"votes":       a.votesStorage,
+		"tokens":      a.tokensStorage,
+		"delegations": a.delegationsStorage,
+	}
+
+	for source, st := range storages {
+		if count := st.Uncommitted(); count > 0 {
+			log.Error().
+				Str("source", source).
+				Int64("count_records", count).
+				Bool("wal_enabled", a.cfg.Storage.WALEnabled).
+				Msg("items weren't committed on shutdown")
+		}
+	}
+}
 
-		manager.StopAll()
-	}(a.manager)
+func awaitManager(m *process.Manager) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		m.AwaitAll()
+		close(done)
+	}()
 
-	a.manager.AwaitAll()
+	return done
 }
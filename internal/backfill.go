@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/goverland-labs/goverland-platform-events/events/core"
+	"github.com/rs/zerolog/log"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/dao"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/delegation"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/proposal"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/storage"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/token"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/vote"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/natsack"
+)
+
+const backfillProgressInterval = 10 * time.Second
+
+var BackfillSources = []string{"daos", "proposals", "votes", "tokens", "delegations"}
+
+type BackfillOptions struct {
+	Source        string
+	StartSequence uint64
+	StartTime     time.Time
+	// FlushInterval overrides the max batch duration of the storage worker to not wait for the last batch too long
+	FlushInterval time.Duration
+	// DeadLetters is the path to the file written by the file dead letter sink. Dead letters of the source
+	// are stored again instead of reading the stream.
+	DeadLetters string
+}
+
+type backfiller interface {
+	Backfill(ctx context.Context, opts natsack.ReplayOpts) error
+}
+
+// RunBackfill re-ingests events of the source from the JetStream stream or from the dead letter file
+// through the same consumer handlers and clickhouse storage worker as the service does and returns when
+// all of them are committed.
+func RunBackfill(cfg config.App, opts BackfillOptions) error {
+	// the running service owns the WAL directory, the backfill is restarted from the stream instead
+	cfg.Storage.WALEnabled = false
+
+	a := &Application{cfg: cfg}
+	for _, initializer := range []func() error{a.initClickhouse, a.initNats, a.initStorageOptions} {
+		if err := initializer(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	conn, err := a.createNatsConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch opts.Source {
+	case "daos":
+		st := newClickhouseWorker[dao.Payload](a, opts.Source, dao.ClickhouseAdapter{}, backfillWorkerConfig(cfg.Storage.Daos, opts))
+		return runBackfill(ctx, st, dao.NewConsumer(conn, st), opts)
+	case "proposals":
+		st := newClickhouseWorker[proposal.Payload](a, opts.Source, proposal.ClickhouseAdapter{}, backfillWorkerConfig(cfg.Storage.Proposals, opts))
+		return runBackfill(ctx, st, proposal.NewConsumer(conn, st), opts)
+	case "votes":
+		st := newClickhouseWorker[*core.VotePayload](a, opts.Source, vote.ClickhouseAdapter{}, backfillWorkerConfig(cfg.Storage.Votes, opts))
+		return runBackfill(ctx, st, vote.NewConsumer(conn, st), opts)
+	case "tokens":
+		st := newClickhouseWorker[*core.TokenPricePayload](a, opts.Source, token.ClickhouseAdapter{}, backfillWorkerConfig(cfg.Storage.Tokens, opts))
+		return runBackfill(ctx, st, token.NewConsumer(conn, st), opts)
+	case "delegations":
+		st := newClickhouseWorker[delegation.Payload](a, opts.Source, delegation.ClickhouseAdapter{}, backfillWorkerConfig(cfg.Storage.Delegations, opts))
+		return runBackfill(ctx, st, delegation.NewConsumer(conn, st), opts)
+	default:
+		return fmt.Errorf("unknown backfill source: %s", opts.Source)
+	}
+}
+
+func backfillWorkerConfig(cfg config.StorageWorker, opts BackfillOptions) config.StorageWorker {
+	if opts.FlushInterval > 0 {
+		cfg.MaxBatchDuration = opts.FlushInterval
+	}
+	cfg.Adaptive = false
+
+	return cfg
+}
+
+func runBackfill[T any](ctx context.Context, st *storage.ClickhouseWorker[T], c backfiller, opts BackfillOptions) error {
+	stCtx, stop := context.WithCancel(context.Background())
+	stDone := make(chan error, 1)
+	go func() {
+		stDone <- st.Start(stCtx)
+	}()
+
+	select {
+	case <-st.Ready():
+	case err := <-stDone:
+		stop()
+		return fmt.Errorf("start storage worker: %w", err)
+	}
+
+	var err error
+	if opts.DeadLetters != "" {
+		err = replayDeadLetters(ctx, st, opts)
+	} else {
+		err = backfillStream(ctx, c, opts)
+	}
+
+	stop()
+	if stErr := <-stDone; stErr != nil && !errors.Is(stErr, context.Canceled) {
+		err = errors.Join(err, stErr)
+	}
+
+	return err
+}
+
+func backfillStream(ctx context.Context, c backfiller, opts BackfillOptions) error {
+	var processed uint64
+	lastReport := time.Now()
+	start := time.Now()
+
+	err := c.Backfill(ctx, natsack.ReplayOpts{
+		StartSequence: opts.StartSequence,
+		StartTime:     opts.StartTime,
+		Progress: func(subject string, sequence, lastSequence uint64) {
+			processed++
+			if time.Since(lastReport) < backfillProgressInterval && sequence < lastSequence {
+				return
+			}
+			lastReport = time.Now()
+
+			log.Info().
+				Str("source", opts.Source).
+				Str("subject", subject).
+				Uint64("sequence", sequence).
+				Uint64("last_sequence", lastSequence).
+				Uint64("processed", processed).
+				Msg("backfill progress")
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("source", opts.Source).
+		Uint64("processed", processed).
+		Dur("elapsed", time.Since(start)).
+		Msg("backfill is finished")
+
+	return nil
+}
+
+// replayDeadLetters takes the dead letter file from the sink, stores dead letters of the source again and waits
+// until their items are committed. Letters of other sources and failed ones are appended back to the file.
+func replayDeadLetters[T any](ctx context.Context, st *storage.ClickhouseWorker[T], opts BackfillOptions) error {
+	taken, err := storage.TakeDeadLetters(opts.DeadLetters)
+	if err != nil {
+		return err
+	}
+
+	letters, err := readDeadLetters(taken)
+	if err != nil {
+		return err
+	}
+
+	results := make([]chan error, len(letters))
+	for i, dl := range letters {
+		if dl.Source != opts.Source {
+			continue
+		}
+
+		acked := make(chan error, 1)
+		if err = st.Replay(dl, func(err error) { acked <- err }); err != nil {
+			return fmt.Errorf("replay dead letter failed at %s: %w", dl.FailedAt, err)
+		}
+		results[i] = acked
+	}
+
+	var replayed, failed, items int
+	kept := make([]storage.DeadLetter, 0, len(letters))
+	for i, acked := range results {
+		if acked == nil {
+			kept = append(kept, letters[i])
+			continue
+		}
+
+		// the taken file is replayed again by the next run
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err = <-acked:
+		}
+
+		if err != nil {
+			failed++
+			kept = append(kept, letters[i])
+			log.Error().
+				Err(err).
+				Str("source", opts.Source).
+				Time("failed_at", letters[i].FailedAt).
+				Msg("dead letter wasn't replayed")
+
+			continue
+		}
+
+		replayed++
+		items += len(letters[i].Items)
+	}
+
+	if len(kept) > 0 {
+		if err = storage.AppendDeadLetters(opts.DeadLetters, kept); err != nil {
+			return err
+		}
+	}
+	if err = os.Remove(taken); err != nil {
+		return fmt.Errorf("remove replayed dead letters: %w", err)
+	}
+
+	log.Info().
+		Str("source", opts.Source).
+		Int("replayed_letters", replayed).
+		Int("failed_letters", failed).
+		Int("items", items).
+		Msg("dead letters are replayed")
+
+	if failed > 0 {
+		return fmt.Errorf("%d dead letters weren't replayed", failed)
+	}
+
+	return nil
+}
+
+func readDeadLetters(path string) ([]storage.DeadLetter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letters: %w", err)
+	}
+	defer f.Close()
+
+	return storage.ReadDeadLetters(f)
+}
@@ -7,5 +7,8 @@ type App struct {
 	Pprof       Pprof
 	Nats        Nats
 	ClickHouse  ClickHouse
+	Storage     Storage
+	Cache       Cache
 	InternalAPI InternalAPI
+	Shutdown    Shutdown
 }
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+type Cache struct {
+	Enabled bool `env:"CACHE_ENABLED" envDefault:"false"`
+	// DaoTTL is used for results of the dao, they are also invalidated when rows of the dao are committed
+	DaoTTL       time.Duration `env:"CACHE_DAO_TTL" envDefault:"1h"`
+	EcosystemTTL time.Duration `env:"CACHE_ECOSYSTEM_TTL" envDefault:"10m"`
+	// MaxEntries bounds the number of cached results, the least recently used ones are evicted
+	MaxEntries int `env:"CACHE_MAX_ENTRIES" envDefault:"10000"`
+	// MethodTTLs overrides TTLs of data provider methods, e.g. "GetTopDaos=1h,GetMonthlyVoters=30m"
+	MethodTTLs []string `env:"CACHE_METHOD_TTLS" envSeparator:","`
+}
+
+func (c Cache) ParseMethodTTLs() (map[string]time.Duration, error) {
+	res, err := parseDurations(c.MethodTTLs)
+	if err != nil {
+		return nil, fmt.Errorf("method ttl %w", err)
+	}
+
+	return res, nil
+}
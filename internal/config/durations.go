@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseDurations parses "name=duration" items
+func parseDurations(items []string) (map[string]time.Duration, error) {
+	res := make(map[string]time.Duration, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected name=duration", item)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", item, err)
+		}
+
+		res[strings.TrimSpace(name)] = d
+	}
+
+	return res, nil
+}
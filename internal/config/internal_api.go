@@ -1,5 +1,23 @@
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 type InternalAPI struct {
 	Bind string `env:"INTERNAL_API_GRPC_SERVER_BIND" envDefault:":11000"`
+	// RequestTimeout is the server side deadline of rpc methods, 0 disables it
+	RequestTimeout time.Duration `env:"INTERNAL_API_REQUEST_TIMEOUT" envDefault:"30s"`
+	// MethodTimeouts overrides the deadline per rpc method, e.g. "GetTopDaos=1m,GetVoterBucketsV2=10s"
+	MethodTimeouts []string `env:"INTERNAL_API_METHOD_TIMEOUTS" envSeparator:","`
+}
+
+func (c InternalAPI) ParseMethodTimeouts() (map[string]time.Duration, error) {
+	res, err := parseDurations(c.MethodTimeouts)
+	if err != nil {
+		return nil, fmt.Errorf("method timeout %w", err)
+	}
+
+	return res, nil
 }
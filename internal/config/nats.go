@@ -11,6 +11,23 @@ type Nats struct {
 	ReconnectTimeout time.Duration `env:"NATS_RECONNECT_TIMEOUT" envDefault:"1s"`
 }
 
+// ackWaitMargin covers the time of inserts themselves and message redelivery latency
+const ackWaitMargin = time.Minute
+
 func GenerateGroupName(subgroup string) string {
 	return fmt.Sprintf("analytics_%s", subgroup)
 }
+
+// AckWait returns how long nats should wait for the ack of the message which is acked after the storage commit.
+// In the worst case the item of the message waits for the degraded worker to reconnect, for its batch to be filled,
+// for the commit slot held by the previous batch being retried and for all retries of its own batch.
+func AckWait(maxBatchDuration, maxRetryDelay, maxReconnectDelay time.Duration) time.Duration {
+	return maxReconnectDelay + maxBatchDuration + 2*maxRetryDelay + ackWaitMargin
+}
+
+// MaxAckPending returns how many messages may wait for the ack. Messages are acked after the storage commit,
+// so the limit covers all items the storage worker holds uncommitted: the batches being committed concurrently,
+// the batch being filled and the in-memory queue.
+func MaxAckPending(maxBatchSize, insertConcurrency, channelCapacity uint) int {
+	return int(maxBatchSize*(insertConcurrency+1) + channelCapacity)
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// Shutdown sets the total shutdown budget and the budget of each stage, so the stage exceeding its budget doesn't
+// take the time of the next ones. Stage budgets are capped by the time left of the total one.
+type Shutdown struct {
+	// Timeout limits the whole shutdown
+	Timeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"2m"`
+	// ConsumersTimeout limits draining of delivered nats messages
+	ConsumersTimeout time.Duration `env:"SHUTDOWN_CONSUMERS_TIMEOUT" envDefault:"30s"`
+	// StoragesTimeout limits flushing of storage worker batches to the clickhouse
+	StoragesTimeout time.Duration `env:"SHUTDOWN_STORAGES_TIMEOUT" envDefault:"1m"`
+	// ApplicationTimeout limits stopping of servers and application workers
+	ApplicationTimeout time.Duration `env:"SHUTDOWN_APPLICATION_TIMEOUT" envDefault:"30s"`
+}
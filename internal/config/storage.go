@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DeadLetterSinkNone = "none"
+	DeadLetterSinkFile = "file"
+	DeadLetterSinkNats = "nats"
+)
+
+type Storage struct {
+	CommitRetryAttempts   int           `env:"STORAGE_COMMIT_RETRY_ATTEMPTS" envDefault:"5"`
+	CommitRetryBackoff    time.Duration `env:"STORAGE_COMMIT_RETRY_BACKOFF" envDefault:"1s"`
+	CommitRetryMaxBackoff time.Duration `env:"STORAGE_COMMIT_RETRY_MAX_BACKOFF" envDefault:"1m"`
+	DeadLetterSink        string        `env:"STORAGE_DEAD_LETTER_SINK" envDefault:"file"`
+	DeadLetterDir         string        `env:"STORAGE_DEAD_LETTER_DIR" envDefault:"./dead-letters"`
+	DeadLetterSubject     string        `env:"STORAGE_DEAD_LETTER_SUBJECT" envDefault:"analytics.dead_letter"`
+	WALEnabled            bool          `env:"STORAGE_WAL_ENABLED" envDefault:"false"`
+	WALDir                string        `env:"STORAGE_WAL_DIR" envDefault:"./wal"`
+	WALSyncInterval       time.Duration `env:"STORAGE_WAL_SYNC_INTERVAL" envDefault:"100ms"`
+
+	Daos        StorageWorker `envPrefix:"STORAGE_DAOS_"`
+	Proposals   StorageWorker `envPrefix:"STORAGE_PROPOSALS_"`
+	Votes       StorageWorker `envPrefix:"STORAGE_VOTES_"`
+	Tokens      StorageWorker `envPrefix:"STORAGE_TOKENS_"`
+	Delegations StorageWorker `envPrefix:"STORAGE_DELEGATIONS_"`
+}
+
+// StorageWorker is the batching configuration of the storage worker for one source
+type StorageWorker struct {
+	// MaxBatchSize has no env default, because it differs per source, see DefaultStorage
+	MaxBatchSize     uint          `env:"MAX_BATCH_SIZE"`
+	MaxBatchDuration time.Duration `env:"MAX_BATCH_DURATION" envDefault:"5m"`
+	// ChannelCapacity is the size of the in-memory queue of the worker, 0 means twice the max batch size
+	ChannelCapacity   uint `env:"CHANNEL_CAPACITY" envDefault:"0"`
+	InsertConcurrency uint `env:"INSERT_CONCURRENCY" envDefault:"1"`
+	NativeBatch       bool `env:"NATIVE_BATCH" envDefault:"false"`
+
+	// Adaptive batching tunes batch size and duration between the min and max values by commit latency
+	Adaptive            bool          `env:"ADAPTIVE" envDefault:"false"`
+	MinBatchSize        uint          `env:"MIN_BATCH_SIZE" envDefault:"100"`
+	MinBatchDuration    time.Duration `env:"MIN_BATCH_DURATION" envDefault:"1s"`
+	TargetCommitLatency time.Duration `env:"TARGET_COMMIT_LATENCY" envDefault:"2s"`
+}
+
+// DefaultStorage returns values which can't be set by env defaults. It must be applied before parsing env.
+func DefaultStorage() Storage {
+	return Storage{
+		Daos:        StorageWorker{MaxBatchSize: 1000},
+		Proposals:   StorageWorker{MaxBatchSize: 1000},
+		Votes:       StorageWorker{MaxBatchSize: 50000},
+		Tokens:      StorageWorker{MaxBatchSize: 500},
+		Delegations: StorageWorker{MaxBatchSize: 1000},
+	}
+}
+
+func (s Storage) Validate() error {
+	var errs []error
+
+	if s.CommitRetryAttempts < 0 {
+		errs = append(errs, errors.New("commit retry attempts must not be negative"))
+	}
+	if s.CommitRetryBackoff <= 0 {
+		errs = append(errs, errors.New("commit retry backoff must be positive"))
+	}
+	if s.CommitRetryMaxBackoff < s.CommitRetryBackoff {
+		errs = append(errs, errors.New("commit retry max backoff must not be less than backoff"))
+	}
+
+	if s.WALSyncInterval < 0 {
+		errs = append(errs, errors.New("wal sync interval must not be negative"))
+	}
+
+	switch s.DeadLetterSink {
+	case DeadLetterSinkNone, DeadLetterSinkFile, DeadLetterSinkNats:
+	default:
+		errs = append(errs, fmt.Errorf("unknown dead letter sink: %s", s.DeadLetterSink))
+	}
+
+	workers := map[string]StorageWorker{
+		"daos":        s.Daos,
+		"proposals":   s.Proposals,
+		"votes":       s.Votes,
+		"tokens":      s.Tokens,
+		"delegations": s.Delegations,
+	}
+	for source, w := range workers {
+		if err := w.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w StorageWorker) Validate() error {
+	var errs []error
+
+	if w.MaxBatchSize == 0 {
+		errs = append(errs, errors.New("max batch size must be positive"))
+	}
+	if w.MaxBatchDuration <= 0 {
+		errs = append(errs, errors.New("max batch duration must be positive"))
+	}
+	if w.ChannelCapacity != 0 && w.ChannelCapacity < w.MaxBatchSize {
+		errs = append(errs, errors.New("channel capacity must not be less than max batch size"))
+	}
+	if w.InsertConcurrency == 0 {
+		errs = append(errs, errors.New("insert concurrency must be positive"))
+	}
+
+	if w.Adaptive {
+		if w.MinBatchSize == 0 || w.MinBatchSize > w.MaxBatchSize {
+			errs = append(errs, errors.New("min batch size must be positive and not greater than max batch size"))
+		}
+		if w.MinBatchDuration <= 0 || w.MinBatchDuration > w.MaxBatchDuration {
+			errs = append(errs, errors.New("min batch duration must be positive and not greater than max batch duration"))
+		}
+		if w.TargetCommitLatency <= 0 {
+			errs = append(errs, errors.New("target commit latency must be positive"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
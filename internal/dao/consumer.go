@@ -14,6 +14,7 @@ import (
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/item"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/metrics"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/helpers"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/natsack"
 )
 
 const groupName = "dao"
@@ -28,7 +29,13 @@ type closable interface {
 }
 
 type storage interface {
-	Store(group uint32, items ...Payload) error
+	StoreWithAck(ack func(error), items ...Payload) error
+	MaxBatchSize() uint
+	MaxBatchDuration() time.Duration
+	InsertConcurrency() uint
+	ChannelCapacity() uint
+	MaxRetryDelay() time.Duration
+	MaxReconnectDelay() time.Duration
 }
 
 type Consumer struct {
@@ -45,8 +52,8 @@ func NewConsumer(nc *nats.Conn, s storage) *Consumer {
 	}
 }
 
-func (c *Consumer) handler(action string) pevents.DaoHandler {
-	return func(payload pevents.DaoPayload) error {
+func (c *Consumer) handler(action string) natsack.Handler[pevents.DaoPayload] {
+	return func(payload pevents.DaoPayload, _ natsack.Meta, ack natsack.Ack) error {
 		var err error
 
 		defer func(start time.Time) {
@@ -63,7 +70,7 @@ func (c *Consumer) handler(action string) pevents.DaoHandler {
 			eventType = item.DaoUpdated
 		}
 
-		err = c.storage.Store(payload.ID.ID(), Payload{
+		err = c.storage.StoreWithAck(ack, Payload{
 			Action: string(eventType),
 			DAO:    helpers.Ptr(payload),
 		})
@@ -77,7 +84,10 @@ func (c *Consumer) handler(action string) pevents.DaoHandler {
 func (c *Consumer) Start(ctx context.Context) error {
 	group := config.GenerateGroupName(groupName)
 	for _, subj := range subjects {
-		consumer, err := client.NewConsumer(ctx, c.conn, group, subj, c.handler(subj), client.WithMaxAckPending(10))
+		consumer, err := natsack.NewConsumer(ctx, c.conn, group, subj, c.handler(subj),
+			client.WithMaxAckPending(config.MaxAckPending(c.storage.MaxBatchSize(), c.storage.InsertConcurrency(), c.storage.ChannelCapacity())),
+			client.WithAckWait(config.AckWait(c.storage.MaxBatchDuration(), c.storage.MaxRetryDelay(), c.storage.MaxReconnectDelay())),
+		)
 		if err != nil {
 			return fmt.Errorf("consume for %s/%s: %w", group, subj, err)
 		}
@@ -87,11 +97,22 @@ func (c *Consumer) Start(ctx context.Context) error {
 
 	log.Info().Msg("dao consumers are started")
 
-	// todo: handle correct stopping the consumer by context
 	<-ctx.Done()
 	return c.stop()
 }
 
+// Backfill re-reads the consumer subjects from the start position by the ephemeral consumer and stores
+// events by the same handlers. It returns when all events existing at the moment of the call are committed.
+func (c *Consumer) Backfill(ctx context.Context, opts natsack.ReplayOpts) error {
+	for _, subj := range subjects {
+		if err := natsack.Replay(ctx, c.conn, subj, c.handler(subj), opts); err != nil {
+			return fmt.Errorf("backfill %s: %w", subj, err)
+		}
+	}
+
+	return nil
+}
+
 func (c *Consumer) stop() error {
 	for _, cs := range c.consumers {
 		if err := cs.Close(); err != nil {
@@ -0,0 +1,52 @@
+package delegation
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/goverland-labs/goverland-platform-events/events/core"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/helpers"
+)
+
+type Payload struct {
+	Action string
+	// CreatedAt is the time of the event in the stream, delegation payloads don't contain it
+	CreatedAt  time.Time
+	Delegation *core.DelegatePayload
+}
+
+type ClickhouseAdapter struct {
+}
+
+func (c ClickhouseAdapter) GetInsertQuery() string {
+	return "INSERT INTO delegations_raw (dao_id, event_type, created_at, delegate, delegator, due_date, event_id) VALUES (?, ?, ?, ?, ?, ?, ?)"
+}
+
+func (c ClickhouseAdapter) Values(pl Payload) []any {
+	// delegations without expiration are stored with zero due date
+	dueDate := time.Unix(0, 0)
+	if pl.Delegation.DueDate != nil {
+		dueDate = *pl.Delegation.DueDate
+	}
+
+	return []any{
+		pl.Delegation.DaoID,
+		pl.Action,
+		pl.CreatedAt,
+		pl.Delegation.Initiator,
+		pl.Delegation.Delegator,
+		dueDate,
+		EventID(pl),
+	}
+}
+
+// EventID returns the idempotency key of the delegation event: the same action with the same payload at the same
+// time has the same key. The time keeps repeated delegations of the same pair as separate events.
+func EventID(pl Payload) string {
+	return helpers.EventID(pl.Action, helpers.AsJSON(pl.Delegation), strconv.FormatInt(pl.CreatedAt.UnixNano(), 10))
+}
+
+func (c ClickhouseAdapter) GetCategoryID(pl Payload) uint32 {
+	return pl.Delegation.DaoID.ID()
+}
@@ -0,0 +1,46 @@
+package delegation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goverland-labs/goverland-platform-events/events/core"
+)
+
+func TestValuesUseEventTime(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	pl := Payload{
+		Action:    core.SubjectDelegateCreated,
+		CreatedAt: createdAt,
+		Delegation: &core.DelegatePayload{
+			Initiator: "0xdelegate",
+			Delegator: "0xdelegator",
+			DaoID:     uuid.New(),
+		},
+	}
+
+	values := ClickhouseAdapter{}.Values(pl)
+	if got, ok := values[2].(time.Time); !ok || !got.Equal(createdAt) {
+		t.Fatalf("created_at: %v", values[2])
+	}
+}
+
+func TestEventIDSeparatesRepeatedDelegations(t *testing.T) {
+	delegation := &core.DelegatePayload{
+		Initiator: "0xdelegate",
+		Delegator: "0xdelegator",
+		DaoID:     uuid.New(),
+	}
+	first := Payload{Action: core.SubjectDelegateCreated, CreatedAt: time.Unix(1700000000, 0), Delegation: delegation}
+	redelivered := first
+	repeated := first
+	repeated.CreatedAt = first.CreatedAt.Add(time.Hour)
+
+	if EventID(first) != EventID(redelivered) {
+		t.Fatal("redelivered event has another key")
+	}
+	if EventID(first) == EventID(repeated) {
+		t.Fatal("repeated delegation has the same key")
+	}
+}
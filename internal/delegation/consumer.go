@@ -0,0 +1,120 @@
+package delegation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pevents "github.com/goverland-labs/goverland-platform-events/events/core"
+	client "github.com/goverland-labs/goverland-platform-events/pkg/natsclient"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/metrics"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/helpers"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/natsack"
+)
+
+const groupName = "delegation"
+
+// subjects contain the delegation lifecycle only, delegate activity events aren't stored
+var subjects = []string{
+	pevents.SubjectDelegateCreated,
+	pevents.SubjectDelegateDelegationExpired,
+}
+
+type closable interface {
+	Close() error
+}
+
+type storage interface {
+	StoreWithAck(ack func(error), items ...Payload) error
+	MaxBatchSize() uint
+	MaxBatchDuration() time.Duration
+	InsertConcurrency() uint
+	ChannelCapacity() uint
+	MaxRetryDelay() time.Duration
+	MaxReconnectDelay() time.Duration
+}
+
+type Consumer struct {
+	conn      *nats.Conn
+	consumers []closable
+	storage   storage
+}
+
+func NewConsumer(nc *nats.Conn, s storage) *Consumer {
+	return &Consumer{
+		conn:      nc,
+		consumers: make([]closable, 0),
+		storage:   s,
+	}
+}
+
+func (c *Consumer) handler(action string) natsack.Handler[pevents.DelegatePayload] {
+	return func(payload pevents.DelegatePayload, meta natsack.Meta, ack natsack.Ack) error {
+		var err error
+
+		defer func(start time.Time) {
+			metricHandleHistogram.
+				WithLabelValues("handle_delegation", metrics.ErrLabelValue(err)).
+				Observe(time.Since(start).Seconds())
+		}(time.Now())
+
+		err = c.storage.StoreWithAck(ack, Payload{
+			Action:     action,
+			CreatedAt:  meta.Timestamp,
+			Delegation: helpers.Ptr(payload),
+		})
+
+		log.Debug().
+			Str("dao_id", payload.DaoID.String()).
+			Str("delegate", payload.Initiator).
+			Msg("delegation was processed")
+
+		return err
+	}
+}
+
+func (c *Consumer) Start(ctx context.Context) error {
+	group := config.GenerateGroupName(groupName)
+	for _, subj := range subjects {
+		consumer, err := natsack.NewConsumer(ctx, c.conn, group, subj, c.handler(subj),
+			client.WithMaxAckPending(config.MaxAckPending(c.storage.MaxBatchSize(), c.storage.InsertConcurrency(), c.storage.ChannelCapacity())),
+			client.WithAckWait(config.AckWait(c.storage.MaxBatchDuration(), c.storage.MaxRetryDelay(), c.storage.MaxReconnectDelay())),
+		)
+		if err != nil {
+			return fmt.Errorf("consume for %s/%s: %w", group, subj, err)
+		}
+
+		c.consumers = append(c.consumers, consumer)
+	}
+
+	log.Info().Msg("delegation consumers are started")
+
+	<-ctx.Done()
+	return c.stop()
+}
+
+// Backfill re-reads the consumer subjects from the start position by the ephemeral consumer and stores
+// events by the same handlers. It returns when all events existing at the moment of the call are committed.
+func (c *Consumer) Backfill(ctx context.Context, opts natsack.ReplayOpts) error {
+	for _, subj := range subjects {
+		if err := natsack.Replay(ctx, c.conn, subj, c.handler(subj), opts); err != nil {
+			return fmt.Errorf("backfill %s: %w", subj, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer) stop() error {
+	for _, cs := range c.consumers {
+		if err := cs.Close(); err != nil {
+			log.Error().Err(err).Msg("cant close delegation consumer")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package item
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/storage"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/cache"
+)
+
+// CachedProvider caches results of heavy DataProvider methods. Results of the dao are invalidated when the
+// storage workers commit rows of the dao, other results are refreshed by TTL only. Current totals and methods
+// used by the popularity index aren't cached. Results are loaded bypassing the clickhouse query cache,
+// otherwise invalidated results would be loaded again from it.
+// Cached results are shared between callers, so they must not be modified.
+type CachedProvider struct {
+	DataProvider
+
+	cache        *cache.Cache
+	daoTTL       time.Duration
+	ecosystemTTL time.Duration
+	methodTTLs   map[string]time.Duration
+}
+
+func NewCachedProvider(dp DataProvider, c *cache.Cache, daoTTL, ecosystemTTL time.Duration, methodTTLs map[string]time.Duration) *CachedProvider {
+	return &CachedProvider{
+		DataProvider: dp,
+		cache:        c,
+		daoTTL:       daoTTL,
+		ecosystemTTL: ecosystemTTL,
+		methodTTLs:   methodTTLs,
+	}
+}
+
+// OnCommit is the storage worker callback, group ids of the storage workers are ids of daos
+func (p *CachedProvider) OnCommit(groups map[uint32]storage.GroupState) {
+	tags := make([]string, 0, len(groups))
+	for group, state := range groups {
+		if state == storage.Committed {
+			tags = append(tags, daoCacheTag(group))
+		}
+	}
+
+	if len(tags) > 0 {
+		p.cache.Invalidate(tags...)
+	}
+}
+
+func (p *CachedProvider) ttl(method string, def time.Duration) time.Duration {
+	if ttl, ok := p.methodTTLs[method]; ok {
+		return ttl
+	}
+
+	return def
+}
+
+func daoCacheTag(group uint32) string {
+	return fmt.Sprintf("dao:%d", group)
+}
+
+func cacheKey(method string, args ...any) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, method)
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+
+	return strings.Join(parts, "|")
+}
+
+func cachedDao[T any](ctx context.Context, p *CachedProvider, method string, id uuid.UUID, load func(ctx context.Context) (T, error), args ...any) (T, error) {
+	key := cacheKey(method, append([]any{id}, args...)...)
+
+	return cache.Load(ctx, p.cache, key, p.ttl(method, p.daoTTL), []string{daoCacheTag(id.ID())}, loadWithoutQueryCache(load))
+}
+
+func cachedEcosystem[T any](ctx context.Context, p *CachedProvider, method string, load func(ctx context.Context) (T, error), args ...any) (T, error) {
+	return cache.Load(ctx, p.cache, cacheKey(method, args...), p.ttl(method, p.ecosystemTTL), nil, loadWithoutQueryCache(load))
+}
+
+func loadWithoutQueryCache[T any](load func(ctx context.Context) (T, error)) func(ctx context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		return load(withoutQueryCache(ctx))
+	}
+}
+
+func (p *CachedProvider) GetMonthlyActiveUsersByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error) {
+	return cachedDao(ctx, p, "GetMonthlyActiveUsersByDaoId", id, func(ctx context.Context) ([]*MonthlyActiveUser, error) {
+		return p.DataProvider.GetMonthlyActiveUsersByDaoId(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetVoterBucketsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
+	return cachedDao(ctx, p, "GetVoterBucketsByDaoId", id, func(ctx context.Context) ([]*Bucket, error) {
+		return p.DataProvider.GetVoterBucketsByDaoId(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetVotesGroupsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
+	return cachedDao(ctx, p, "GetVotesGroupsByDaoId", id, func(ctx context.Context) ([]*Bucket, error) {
+		return p.DataProvider.GetVotesGroupsByDaoId(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetExclusiveVotersByDaoId(ctx context.Context, id uuid.UUID) (*ExclusiveVoters, error) {
+	return cachedDao(ctx, p, "GetExclusiveVotersByDaoId", id, func(ctx context.Context) (*ExclusiveVoters, error) {
+		return p.DataProvider.GetExclusiveVotersByDaoId(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetMonthlyNewProposalsByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*ProposalsByMonth, error) {
+	return cachedDao(ctx, p, "GetMonthlyNewProposalsByDaoId", id, func(ctx context.Context) ([]*ProposalsByMonth, error) {
+		return p.DataProvider.GetMonthlyNewProposalsByDaoId(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetProposalsCountByDaoId(ctx context.Context, id uuid.UUID) (*FinalProposalCounts, error) {
+	return cachedDao(ctx, p, "GetProposalsCountByDaoId", id, func(ctx context.Context) (*FinalProposalCounts, error) {
+		return p.DataProvider.GetProposalsCountByDaoId(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetTopVotersByVp(ctx context.Context, id uuid.UUID, limit int, offset int, period uint32) ([]*VoterWithVp, error) {
+	return cachedDao(ctx, p, "GetTopVotersByVp", id, func(ctx context.Context) ([]*VoterWithVp, error) {
+		return p.DataProvider.GetTopVotersByVp(ctx, id, limit, offset, period)
+	}, limit, offset, period)
+}
+
+func (p *CachedProvider) GetTotalVpAvgForActiveVoters(ctx context.Context, id uuid.UUID, period uint32) (*VpAvgTotal, error) {
+	return cachedDao(ctx, p, "GetTotalVpAvgForActiveVoters", id, func(ctx context.Context) (*VpAvgTotal, error) {
+		return p.DataProvider.GetTotalVpAvgForActiveVoters(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetVpAvgList(ctx context.Context, id uuid.UUID, period uint32, price float32) ([]float32, error) {
+	return cachedDao(ctx, p, "GetVpAvgList", id, func(ctx context.Context) ([]float32, error) {
+		return p.DataProvider.GetVpAvgList(ctx, id, period, price)
+	}, period, price)
+}
+
+func (p *CachedProvider) GetTokenPrice(ctx context.Context, id uuid.UUID) (float32, error) {
+	return cachedDao(ctx, p, "GetTokenPrice", id, func(ctx context.Context) (float32, error) {
+		return p.DataProvider.GetTokenPrice(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetProposalVotesTimeline(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalVotesBucket, error) {
+	return cachedDao(ctx, p, "GetProposalVotesTimeline", daoID, func(ctx context.Context) ([]*ProposalVotesBucket, error) {
+		return p.DataProvider.GetProposalVotesTimeline(ctx, daoID, proposalID)
+	}, proposalID)
+}
+
+func (p *CachedProvider) GetProposalChoices(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalChoice, error) {
+	return cachedDao(ctx, p, "GetProposalChoices", daoID, func(ctx context.Context) ([]*ProposalChoice, error) {
+		return p.DataProvider.GetProposalChoices(ctx, daoID, proposalID)
+	}, proposalID)
+}
+
+func (p *CachedProvider) GetProposalVpTotals(ctx context.Context, daoID uuid.UUID, proposalID string, finalPeriodFrom time.Time, quorum float64) (*ProposalVpTotals, error) {
+	return cachedDao(ctx, p, "GetProposalVpTotals", daoID, func(ctx context.Context) (*ProposalVpTotals, error) {
+		return p.DataProvider.GetProposalVpTotals(ctx, daoID, proposalID, finalPeriodFrom, quorum)
+	}, proposalID, finalPeriodFrom.Unix(), quorum)
+}
+
+func (p *CachedProvider) GetVoterRetention(ctx context.Context, id uuid.UUID, months uint32) ([]*RetentionCell, error) {
+	return cachedDao(ctx, p, "GetVoterRetention", id, func(ctx context.Context) ([]*RetentionCell, error) {
+		return p.DataProvider.GetVoterRetention(ctx, id, months)
+	}, months)
+}
+
+func (p *CachedProvider) GetVpConcentration(ctx context.Context, id uuid.UUID, period uint32) (*VpConcentration, error) {
+	return cachedDao(ctx, p, "GetVpConcentration", id, func(ctx context.Context) (*VpConcentration, error) {
+		return p.DataProvider.GetVpConcentration(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetMonthlyVpConcentration(ctx context.Context, id uuid.UUID, period uint32) ([]*VpConcentration, error) {
+	return cachedDao(ctx, p, "GetMonthlyVpConcentration", id, func(ctx context.Context) ([]*VpConcentration, error) {
+		return p.DataProvider.GetMonthlyVpConcentration(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetProposalOutcomes(ctx context.Context, id uuid.UUID) ([]*ProposalOutcome, error) {
+	return cachedDao(ctx, p, "GetProposalOutcomes", id, func(ctx context.Context) ([]*ProposalOutcome, error) {
+		return p.DataProvider.GetProposalOutcomes(ctx, id)
+	})
+}
+
+func (p *CachedProvider) GetTopDelegates(ctx context.Context, id uuid.UUID, limit int, offset int) ([]*Delegate, error) {
+	return cachedDao(ctx, p, "GetTopDelegates", id, func(ctx context.Context) ([]*Delegate, error) {
+		return p.DataProvider.GetTopDelegates(ctx, id, limit, offset)
+	}, limit, offset)
+}
+
+func (p *CachedProvider) GetDelegatedVp(ctx context.Context, id uuid.UUID, period uint32) (*DelegatedVp, error) {
+	return cachedDao(ctx, p, "GetDelegatedVp", id, func(ctx context.Context) (*DelegatedVp, error) {
+		return p.DataProvider.GetDelegatedVp(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetQuorumProposals(ctx context.Context, id uuid.UUID, period uint32) ([]*QuorumProposal, error) {
+	return cachedDao(ctx, p, "GetQuorumProposals", id, func(ctx context.Context) ([]*QuorumProposal, error) {
+		return p.DataProvider.GetQuorumProposals(ctx, id, period)
+	}, period)
+}
+
+func (p *CachedProvider) GetTopAuthors(ctx context.Context, id uuid.UUID, period uint32, limit int, offset int) ([]*DaoAuthor, error) {
+	return cachedDao(ctx, p, "GetTopAuthors", id, func(ctx context.Context) ([]*DaoAuthor, error) {
+		return p.DataProvider.GetTopAuthors(ctx, id, period, limit, offset)
+	}, period, limit, offset)
+}
+
+func (p *CachedProvider) GetMonthlyVotingApps(ctx context.Context, id uuid.UUID, period uint32) ([]*AppVotes, error) {
+	load := func(ctx context.Context) ([]*AppVotes, error) {
+		return p.DataProvider.GetMonthlyVotingApps(ctx, id, period)
+	}
+	if id == uuid.Nil {
+		return cachedEcosystem(ctx, p, "GetMonthlyVotingApps", load, period)
+	}
+
+	return cachedDao(ctx, p, "GetMonthlyVotingApps", id, load, period)
+}
+
+func (p *CachedProvider) GetMonthlyStrategyVp(ctx context.Context, id uuid.UUID, proposalID string, period uint32) ([]*StrategyVp, error) {
+	return cachedDao(ctx, p, "GetMonthlyStrategyVp", id, func(ctx context.Context) ([]*StrategyVp, error) {
+		return p.DataProvider.GetMonthlyStrategyVp(ctx, id, proposalID, period)
+	}, proposalID, period)
+}
+
+func (p *CachedProvider) GetVoterTotalsForPeriods(ctx context.Context, periodInDays uint32) (*VoterTotals, error) {
+	return cachedEcosystem(ctx, p, "GetVoterTotalsForPeriods", func(ctx context.Context) (*VoterTotals, error) {
+		return p.DataProvider.GetVoterTotalsForPeriods(ctx, periodInDays)
+	}, periodInDays)
+}
+
+func (p *CachedProvider) GetDaoProposalTotalsForPeriods(ctx context.Context, periodInDays uint32) (*ActiveDaoProposalTotals, error) {
+	return cachedEcosystem(ctx, p, "GetDaoProposalTotalsForPeriods", func(ctx context.Context) (*ActiveDaoProposalTotals, error) {
+		return p.DataProvider.GetDaoProposalTotalsForPeriods(ctx, periodInDays)
+	}, periodInDays)
+}
+
+func (p *CachedProvider) GetMonthlyDaos(ctx context.Context) ([]*MonthlyTotal, error) {
+	return cachedEcosystem(ctx, p, "GetMonthlyDaos", p.DataProvider.GetMonthlyDaos)
+}
+
+func (p *CachedProvider) GetMonthlyProposals(ctx context.Context) ([]*MonthlyTotal, error) {
+	return cachedEcosystem(ctx, p, "GetMonthlyProposals", p.DataProvider.GetMonthlyProposals)
+}
+
+func (p *CachedProvider) GetMonthlyVoters(ctx context.Context) ([]*MonthlyTotal, error) {
+	return cachedEcosystem(ctx, p, "GetMonthlyVoters", p.DataProvider.GetMonthlyVoters)
+}
+
+func (p *CachedProvider) GetVoterDaos(ctx context.Context, voter string) ([]*VoterDao, error) {
+	return cachedEcosystem(ctx, p, "GetVoterDaos", func(ctx context.Context) ([]*VoterDao, error) {
+		return p.DataProvider.GetVoterDaos(ctx, voter)
+	}, voter)
+}
+
+func (p *CachedProvider) GetVoterMonthlyActivity(ctx context.Context, voter string) ([]*VoterMonthlyActivity, error) {
+	return cachedEcosystem(ctx, p, "GetVoterMonthlyActivity", func(ctx context.Context) ([]*VoterMonthlyActivity, error) {
+		return p.DataProvider.GetVoterMonthlyActivity(ctx, voter)
+	}, voter)
+}
+
+func (p *CachedProvider) GetAuthorDaos(ctx context.Context, author string) ([]*AuthorDao, error) {
+	return cachedEcosystem(ctx, p, "GetAuthorDaos", func(ctx context.Context) ([]*AuthorDao, error) {
+		return p.DataProvider.GetAuthorDaos(ctx, author)
+	}, author)
+}
+
+func (p *CachedProvider) GetTopVotersByVpAfter(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time, after *RankKey, limit int) ([]*RankedVoter, error) {
+	return cachedDao(ctx, p, "GetTopVotersByVpAfter", id, func(ctx context.Context) ([]*RankedVoter, error) {
+		return p.DataProvider.GetTopVotersByVpAfter(ctx, id, period, asOf, after, limit)
+	}, period, asOf.Unix(), rankKeyArg(after), limit)
+}
+
+func (p *CachedProvider) GetVotersCount(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time) (uint64, error) {
+	return cachedDao(ctx, p, "GetVotersCount", id, func(ctx context.Context) (uint64, error) {
+		return p.DataProvider.GetVotersCount(ctx, id, period, asOf)
+	}, period, asOf.Unix())
+}
+
+func (p *CachedProvider) GetMutualDaosAfter(ctx context.Context, id uuid.UUID, asOf time.Time, after *RankKey, limit int) ([]*RankedMutualDao, error) {
+	return cachedDao(ctx, p, "GetMutualDaosAfter", id, func(ctx context.Context) ([]*RankedMutualDao, error) {
+		return p.DataProvider.GetMutualDaosAfter(ctx, id, asOf, after, limit)
+	}, asOf.Unix(), rankKeyArg(after), limit)
+}
+
+func (p *CachedProvider) GetMutualDaosCount(ctx context.Context, id uuid.UUID, asOf time.Time) (uint64, error) {
+	return cachedDao(ctx, p, "GetMutualDaosCount", id, func(ctx context.Context) (uint64, error) {
+		return p.DataProvider.GetMutualDaosCount(ctx, id, asOf)
+	}, asOf.Unix())
+}
+
+func (p *CachedProvider) GetTopDaosAfter(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time, after *RankKey, limit int) ([]*TopDao, error) {
+	return cachedEcosystem(ctx, p, "GetTopDaosAfter", func(ctx context.Context) ([]*TopDao, error) {
+		return p.DataProvider.GetTopDaosAfter(ctx, category, interval, pricePeriod, asOf, after, limit)
+	}, category, interval, pricePeriod, asOf.Unix(), rankKeyArg(after), limit)
+}
+
+func (p *CachedProvider) GetTopDaosCount(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time) (uint64, error) {
+	return cachedEcosystem(ctx, p, "GetTopDaosCount", func(ctx context.Context) (uint64, error) {
+		return p.DataProvider.GetTopDaosCount(ctx, category, interval, pricePeriod, asOf)
+	}, category, interval, pricePeriod, asOf.Unix())
+}
+
+func rankKeyArg(key *RankKey) string {
+	if key == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v:%d:%d:%s", key.Value, key.Count, key.Time.Unix(), key.ID)
+}
@@ -0,0 +1,81 @@
+package item
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/storage"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/cache"
+)
+
+// fakeProvider implements methods used by the tests, other methods of the embedded nil provider panic
+type fakeProvider struct {
+	DataProvider
+
+	calls             int
+	queryCacheEnabled bool
+}
+
+func (p *fakeProvider) GetVoterBucketsByDaoId(ctx context.Context, _ uuid.UUID) ([]*Bucket, error) {
+	p.calls++
+	p.queryCacheEnabled = p.queryCacheEnabled || !queryCacheDisabled(ctx)
+
+	return []*Bucket{{GroupId: uint32(p.calls)}}, nil
+}
+
+func (p *fakeProvider) GetMonthlyDaos(ctx context.Context) ([]*MonthlyTotal, error) {
+	p.calls++
+	p.queryCacheEnabled = p.queryCacheEnabled || !queryCacheDisabled(ctx)
+
+	return nil, nil
+}
+
+func TestCachedProviderLoadsWithoutQueryCache(t *testing.T) {
+	fake := &fakeProvider{}
+	p := NewCachedProvider(fake, cache.New(0), time.Hour, time.Hour, nil)
+
+	if _, err := p.GetVoterBucketsByDaoId(context.Background(), uuid.New()); err != nil {
+		t.Fatalf("dao method: %v", err)
+	}
+	if _, err := p.GetMonthlyDaos(context.Background()); err != nil {
+		t.Fatalf("ecosystem method: %v", err)
+	}
+	if fake.queryCacheEnabled {
+		t.Fatal("cached results are loaded from the query cache")
+	}
+}
+
+func TestCachedProviderInvalidatesDaoOnCommit(t *testing.T) {
+	id := uuid.New()
+	other := uuid.New()
+
+	for name, tc := range map[string]struct {
+		groups map[uint32]storage.GroupState
+		want   int
+	}{
+		"committed dao is loaded again":  {groups: map[uint32]storage.GroupState{id.ID(): storage.Committed}, want: 2},
+		"failed commit keeps the result": {groups: map[uint32]storage.GroupState{id.ID(): storage.Failed}, want: 1},
+		"other dao keeps the result":     {groups: map[uint32]storage.GroupState{other.ID(): storage.Committed}, want: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeProvider{}
+			p := NewCachedProvider(fake, cache.New(0), time.Hour, time.Hour, nil)
+
+			if _, err := p.GetVoterBucketsByDaoId(context.Background(), id); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			p.OnCommit(tc.groups)
+
+			res, err := p.GetVoterBucketsByDaoId(context.Background(), id)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if got := int(res[0].GroupId); got != tc.want {
+				t.Fatalf("loads: got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package item
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	topVotersList  = "top_voters"
+	mutualDaosList = "mutual_daos"
+	topDaosList    = "top_daos"
+
+	// wholeList is the default limit of lists which are returned whole without the limit and cursor
+	wholeList = 0
+)
+
+// pageCursor is the position in the ranked list. All pages are read as of the time of the first page and the total
+// is counted once for the same snapshot, so rows created after it don't shift pages. Events are committed up to
+// the max commit delay of storage workers late with their own time, so rows committed late with the time before
+// the snapshot may still change ranks between pages.
+type pageCursor struct {
+	List     string    `json:"l"`
+	Scope    string    `json:"s"`
+	AsOf     time.Time `json:"a"`
+	Total    uint64    `json:"n"`
+	Position uint64    `json:"p"`
+	Key      RankKey   `json:"k"`
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns nil for the empty token, the cursor must belong to the same list with the same parameters
+func decodeCursor(token, list, scope string) (*pageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var v validator
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		v.add("cursor", "malformed")
+
+		return nil, v.err()
+	}
+
+	var c pageCursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		v.add("cursor", "malformed")
+
+		return nil, v.err()
+	}
+
+	if c.List != list || c.Scope != scope {
+		v.add("cursor", "belongs to another list")
+
+		return nil, v.err()
+	}
+
+	return &c, nil
+}
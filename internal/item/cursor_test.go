@@ -0,0 +1,179 @@
+package item
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	cursor := pageCursor{
+		List:     topVotersList,
+		Scope:    "dao:12",
+		AsOf:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Total:    42,
+		Position: 10,
+		Key:      RankKey{Value: 1.5, Count: 3, Time: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), ID: "0xvoter"},
+	}
+
+	for name, tc := range map[string]struct {
+		token     string
+		list      string
+		scope     string
+		want      *pageCursor
+		violation bool
+	}{
+		"empty token is the first page": {token: "", list: topVotersList, scope: "dao:12"},
+		"encoded cursor":                {token: encodeCursor(cursor), list: topVotersList, scope: "dao:12", want: &cursor},
+		"not base64":                    {token: "%%%", list: topVotersList, scope: "dao:12", violation: true},
+		"not json":                      {token: base64.RawURLEncoding.EncodeToString([]byte("cursor")), list: topVotersList, scope: "dao:12", violation: true},
+		"cursor of another list":        {token: encodeCursor(cursor), list: mutualDaosList, scope: "dao:12", violation: true},
+		"cursor of another scope":       {token: encodeCursor(cursor), list: topVotersList, scope: "dao:1", violation: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := decodeCursor(tc.token, tc.list, tc.scope)
+			if fields := violatedFields(t, err); tc.violation != (len(fields) == 1 && fields[0] == "cursor") {
+				t.Fatalf("violations: %v", fields)
+			}
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("cursor: %+v", got)
+				}
+
+				return
+			}
+			if got == nil || got.Position != tc.want.Position || got.Total != tc.want.Total ||
+				!got.AsOf.Equal(tc.want.AsOf) || got.Key.ID != tc.want.Key.ID || got.Key.Value != tc.want.Key.Value ||
+				got.Key.Count != tc.want.Key.Count || !got.Key.Time.Equal(tc.want.Key.Time) {
+				t.Fatalf("cursor: got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// rankedList is the ranked list of ids 1..n read after the key like repository methods do
+type rankedList struct {
+	n      int
+	counts int
+}
+
+func (l *rankedList) count(time.Time) (uint64, error) {
+	l.counts++
+
+	return uint64(l.n), nil
+}
+
+func (l *rankedList) load(_ time.Time, after *RankKey, limit int) ([]int, error) {
+	from := 1
+	if after != nil {
+		from = int(after.Count) + 1
+	}
+
+	var res []int
+	for i := from; i <= l.n && len(res) < limit; i++ {
+		res = append(res, i)
+	}
+
+	return res, nil
+}
+
+func (l *rankedList) key(row int) RankKey {
+	return RankKey{Count: uint64(row)}
+}
+
+func TestReadPage(t *testing.T) {
+	for name, tc := range map[string]struct {
+		rows  int
+		limit uint32
+		want  [][]int
+	}{
+		"single page":          {rows: 3, limit: 5, want: [][]int{{1, 2, 3}}},
+		"exactly full page":    {rows: 4, limit: 2, want: [][]int{{1, 2}, {3, 4}}},
+		"last page is partial": {rows: 5, limit: 2, want: [][]int{{1, 2}, {3, 4}, {5}}},
+		"empty list":           {rows: 0, limit: 2, want: [][]int{nil}},
+		"unset limit":          {rows: defaultListLimit + 1, limit: 0, want: [][]int{nil, {defaultListLimit + 1}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			list := &rankedList{n: tc.rows}
+
+			token := ""
+			for i, want := range tc.want {
+				page, position, err := readPage(token, topVotersList, "scope", tc.limit, defaultListLimit, list.count, list.load, list.key)
+				if err != nil {
+					t.Fatalf("page %d: %v", i, err)
+				}
+				if page.Total != uint64(tc.rows) {
+					t.Fatalf("page %d total: %d", i, page.Total)
+				}
+				if want != nil && fmt.Sprint(page.Items) != fmt.Sprint(want) {
+					t.Fatalf("page %d: got %v, want %v", i, page.Items, want)
+				}
+				if len(page.Items) > 0 && position != uint64(page.Items[0]-1) {
+					t.Fatalf("page %d position: %d", i, position)
+				}
+
+				last := i == len(tc.want)-1
+				if last != (page.NextCursor == "") {
+					t.Fatalf("page %d next cursor: %q", i, page.NextCursor)
+				}
+				token = page.NextCursor
+			}
+
+			if list.counts != 1 {
+				t.Fatalf("total was counted %d times", list.counts)
+			}
+		})
+	}
+}
+
+func TestReadPageWholeList(t *testing.T) {
+	list := &rankedList{n: defaultListLimit + 1}
+
+	page, _, err := readPage("", topDaosList, "scope", 0, wholeList, list.count, list.load, list.key)
+	if err != nil {
+		t.Fatalf("page: %v", err)
+	}
+	if len(page.Items) != list.n || page.Total != uint64(list.n) || page.NextCursor != "" {
+		t.Fatalf("whole list: %d items, total %d, next cursor %q", len(page.Items), page.Total, page.NextCursor)
+	}
+
+	// the limit pages the list
+	page, _, err = readPage("", topDaosList, "scope", 10, wholeList, list.count, list.load, list.key)
+	if err != nil {
+		t.Fatalf("page: %v", err)
+	}
+	if len(page.Items) != 10 || page.NextCursor == "" {
+		t.Fatalf("first page: %d items, next cursor %q", len(page.Items), page.NextCursor)
+	}
+
+	// next pages without the limit use the default one
+	page, _, err = readPage(page.NextCursor, topDaosList, "scope", 0, wholeList, list.count, list.load, list.key)
+	if err != nil {
+		t.Fatalf("page: %v", err)
+	}
+	if len(page.Items) != defaultListLimit-9 || page.Items[0] != 11 {
+		t.Fatalf("next page: %d items from %v", len(page.Items), page.Items[0])
+	}
+}
+
+func TestReadPageValidation(t *testing.T) {
+	list := &rankedList{n: 10}
+	otherList := encodeCursor(pageCursor{List: topDaosList, Scope: "scope"})
+
+	for name, tc := range map[string]struct {
+		token string
+		limit uint32
+		want  []string
+	}{
+		"too large limit":        {limit: maxListLimit + 1, want: []string{"limit"}},
+		"cursor of another list": {token: otherList, limit: 10, want: []string{"cursor"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := readPage(tc.token, topVotersList, "scope", tc.limit, defaultListLimit, list.count, list.load, list.key)
+			if got := violatedFields(t, err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("violations: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
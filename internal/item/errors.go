@@ -0,0 +1,175 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gorm.io/gorm"
+)
+
+const (
+	errorDomain = "analytics.goverland.xyz"
+
+	// unavailableRetryDelay is suggested to clients when the clickhouse is unavailable
+	unavailableRetryDelay = 5 * time.Second
+)
+
+// clickhouse exception codes which aren't internal errors
+const (
+	chTimeoutExceeded            int32 = 159
+	chTooManySimultaneousQueries int32 = 202
+	chQueryWasCancelled          int32 = 394
+)
+
+// FieldViolation describes the invalid field of the request
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError is returned when the request isn't valid, it's translated to InvalidArgument
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = fmt.Sprintf("%s: %s", v.Field, v.Description)
+	}
+
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// UnaryErrorInterceptor translates errors returned by handlers to grpc statuses
+func UnaryErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		return nil, statusError(info.FullMethod, err)
+	}
+}
+
+// statusError translates the handler error to the grpc status error and logs internal errors. Streaming handlers
+// aren't covered by the unary interceptor, so they call it themselves.
+func statusError(method string, err error) error {
+	st := toStatus(err)
+	if st.Code() == codes.Internal || st.Code() == codes.Unavailable {
+		log.Error().Err(err).Str("method", method).Msg("handle request")
+	}
+
+	return st.Err()
+}
+
+// toStatus maps validation, repository and context errors to grpc statuses with details
+func toStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(validationErr.Violations))
+		for i, v := range validationErr.Violations {
+			violations[i] = &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			}
+		}
+
+		return withDetails(status.New(codes.InvalidArgument, validationErr.Error()), &errdetails.BadRequest{
+			FieldViolations: violations,
+		})
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return withDetails(status.New(codes.NotFound, "not found"), errorInfo("NOT_FOUND"))
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return withDetails(status.New(codes.DeadlineExceeded, "deadline exceeded"), errorInfo("DEADLINE_EXCEEDED"))
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.New(codes.Canceled, "canceled")
+	}
+
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		switch exception.Code {
+		case chTimeoutExceeded:
+			return withDetails(status.New(codes.DeadlineExceeded, "query timeout exceeded"), errorInfo("QUERY_TIMEOUT"))
+		case chQueryWasCancelled:
+			return status.New(codes.Canceled, "query was cancelled")
+		case chTooManySimultaneousQueries:
+			return unavailable()
+		}
+
+		return withDetails(status.New(codes.Internal, "internal error"), errorInfo("QUERY_FAILED"))
+	}
+
+	if isConnectionError(err) {
+		return unavailable()
+	}
+
+	return withDetails(status.New(codes.Internal, "internal error"), errorInfo("INTERNAL"))
+}
+
+func isConnectionError(err error) bool {
+	var netErr net.Error
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, clickhouse.ErrAcquireConnTimeout) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+func unavailable() *status.Status {
+	return withDetails(status.New(codes.Unavailable, "storage unavailable"),
+		errorInfo("STORAGE_UNAVAILABLE"),
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(unavailableRetryDelay)},
+	)
+}
+
+func errorInfo(reason string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	}
+}
+
+func withDetails(st *status.Status, details ...protoiface.MessageV1) *status.Status {
+	res, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+
+	return res
+}
@@ -0,0 +1,86 @@
+package item
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestToStatus(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		"validation error": {
+			err:  &ValidationError{Violations: []FieldViolation{{Field: "dao_id", Description: "required"}}},
+			code: codes.InvalidArgument,
+		},
+		"record not found":    {err: fmt.Errorf("get dao: %w", gorm.ErrRecordNotFound), code: codes.NotFound, reason: "NOT_FOUND"},
+		"deadline exceeded":   {err: fmt.Errorf("query: %w", context.DeadlineExceeded), code: codes.DeadlineExceeded, reason: "DEADLINE_EXCEEDED"},
+		"canceled":            {err: context.Canceled, code: codes.Canceled},
+		"query timeout":       {err: &clickhouse.Exception{Code: chTimeoutExceeded}, code: codes.DeadlineExceeded, reason: "QUERY_TIMEOUT"},
+		"query cancelled":     {err: &clickhouse.Exception{Code: chQueryWasCancelled}, code: codes.Canceled},
+		"too many queries":    {err: &clickhouse.Exception{Code: chTooManySimultaneousQueries}, code: codes.Unavailable, reason: "STORAGE_UNAVAILABLE"},
+		"query failed":        {err: &clickhouse.Exception{Code: 62}, code: codes.Internal, reason: "QUERY_FAILED"},
+		"bad connection":      {err: fmt.Errorf("query: %w", driver.ErrBadConn), code: codes.Unavailable, reason: "STORAGE_UNAVAILABLE"},
+		"connection closed":   {err: io.EOF, code: codes.Unavailable, reason: "STORAGE_UNAVAILABLE"},
+		"grpc status is kept": {err: status.Error(codes.PermissionDenied, "denied"), code: codes.PermissionDenied},
+		"unknown error":       {err: errors.New("unexpected"), code: codes.Internal, reason: "INTERNAL"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			st := toStatus(tc.err)
+			if st.Code() != tc.code {
+				t.Fatalf("code: got %s, want %s", st.Code(), tc.code)
+			}
+
+			reason := ""
+			for _, detail := range st.Details() {
+				if info, ok := detail.(*errdetails.ErrorInfo); ok {
+					reason = info.GetReason()
+				}
+			}
+			if reason != tc.reason {
+				t.Fatalf("reason: got %q, want %q", reason, tc.reason)
+			}
+		})
+	}
+}
+
+func TestToStatusValidationDetails(t *testing.T) {
+	st := toStatus(&ValidationError{Violations: []FieldViolation{
+		{Field: "dao_id", Description: "required"},
+		{Field: "limit", Description: "must be at most 1000"},
+	}})
+
+	var badRequest *errdetails.BadRequest
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			badRequest = br
+		}
+	}
+	if badRequest == nil {
+		t.Fatal("bad request details are missing")
+	}
+
+	violations := badRequest.GetFieldViolations()
+	if len(violations) != 2 || violations[0].GetField() != "dao_id" || violations[1].GetField() != "limit" {
+		t.Fatalf("field violations: %v", violations)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	err := statusError("/test/Method", fmt.Errorf("query: %w", context.DeadlineExceeded))
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("status error: %v", err)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	events "github.com/goverland-labs/goverland-platform-events/events/core"
 )
 
+// GoverlandApp is the app of votes cast in Goverland
+const GoverlandApp = "goverland"
+
 const (
 	None       EventType = ""
 	DaoCreated EventType = "dao_created"
@@ -187,6 +190,290 @@ type TopDao struct {
 	TokenPriceChange float32
 }
 
+type ProposalInfo struct {
+	DaoID  uuid.UUID
+	Start  int64
+	End    int64
+	Quorum float64
+}
+
+type ProposalVotesBucket struct {
+	PeriodStarted time.Time
+	Voters        uint64
+	Vp            float64
+}
+
+// ProposalChoice is the vote choice as it's stored in votes: the index of the choice for single choice
+// proposals and JSON for weighted, ranked and approval ones
+type ProposalChoice struct {
+	Choice string
+	Voters uint64
+	Vp     float64
+}
+
+type ProposalVpTotals struct {
+	Vp              float64
+	FinalPeriodVp   float64
+	QuorumReachedAt *time.Time
+}
+
+type ProposalAnalytics struct {
+	ProposalID string
+	DaoID      uuid.UUID
+	Start      time.Time
+	End        time.Time
+	Quorum     float64
+	// Timeline contains cumulative voters and vp by hours from the proposal start to the end
+	Timeline []*ProposalVotesBucket
+	Choices  []*ProposalChoice
+	// TimeToQuorum is nil if the proposal has no quorum or it isn't reached
+	TimeToQuorum *time.Duration
+	// FinalDayVpShare is the share of vp cast in the last 24 hours of voting, from 0 to 1
+	FinalDayVpShare float64
+}
+
+type VoterDao struct {
+	DaoID     uuid.UUID
+	FirstVote time.Time
+	LastVote  time.Time
+	Votes     uint64
+	VpAvg     float64
+	// Proposals is the number of not spam proposals of the dao finished after the first vote of the voter
+	Proposals uint64
+	// ParticipationRate is votes divided by proposals, from 0 to 1
+	ParticipationRate float64
+}
+
+type VoterMonthlyActivity struct {
+	PeriodStarted time.Time
+	Votes         uint64
+	Daos          uint64
+}
+
+type VoterProfile struct {
+	Voter           string
+	TotalVotes      uint64
+	Daos            []*VoterDao
+	MonthlyActivity []*VoterMonthlyActivity
+}
+
+type RetentionCell struct {
+	Cohort        time.Time
+	PeriodStarted time.Time
+	Voters        uint64
+}
+
+// RetentionCohort contains voters of the first vote month. Active[i] is the number of them who voted
+// i months after the cohort month, so Active[0] equals to Size.
+type RetentionCohort struct {
+	Cohort time.Time
+	Size   uint64
+	Active []uint64
+}
+
+// VpConcentration is calculated by average vp of voters. PeriodStarted is set for monthly values only.
+type VpConcentration struct {
+	PeriodStarted time.Time
+	Voters        uint64
+	TotalVp       float64
+	Gini          float64
+	// Nakamoto is the minimum number of voters controlling more than 50% of vp
+	Nakamoto   uint64
+	Hhi        float64
+	Top10Share float64
+}
+
+type VpConcentrationReport struct {
+	Current *VpConcentration
+	History []*VpConcentration
+}
+
+type ProposalOutcome struct {
+	ProposalID string
+	EndAt      time.Time
+	Winner     string
+	// WinnerWithoutTop1 and WinnerWithoutTop3 are empty if there are no other votes
+	WinnerWithoutTop1 string
+	WinnerWithoutTop3 string
+}
+
+type WhaleDecidedProposal struct {
+	ProposalID    string
+	EndAt         time.Time
+	Winner        string
+	DecidedByTop1 bool
+	DecidedByTop3 bool
+}
+
+type WhaleDecidedMonth struct {
+	PeriodStarted time.Time
+	Proposals     uint64
+	DecidedByTop1 uint64
+	DecidedByTop3 uint64
+	// Top1Share and Top3Share are shares of proposals decided by the top voters, from 0 to 1
+	Top1Share float64
+	Top3Share float64
+}
+
+type WhaleDecidedReport struct {
+	Proposals []*WhaleDecidedProposal
+	History   []*WhaleDecidedMonth
+}
+
+type Delegate struct {
+	Delegate   string
+	Delegators uint64
+	VpAvg      float64
+	VotesCount uint64
+}
+
+// DelegatedVp is calculated by average vp of voters. Delegation events don't contain vp, so the delegated vp is
+// the vp of votes given by delegation strategies of proposals.
+type DelegatedVp struct {
+	Delegates   uint64
+	Delegators  uint64
+	DelegatedVp float64
+	TotalVp     float64
+	// Share is DelegatedVp divided by TotalVp, from 0 to 1
+	Share float64
+}
+
+type QuorumProposal struct {
+	ProposalID      string
+	Start           time.Time
+	End             time.Time
+	Quorum          float64
+	ScoresTotal     float64
+	Votes           uint64
+	State           string
+	Type            string
+	Scores          []float32
+	QuorumReachedAt *time.Time
+
+	// Turnout is ScoresTotal relative to Quorum, 1 means the quorum is reached exactly
+	Turnout      float64
+	TimeToQuorum *time.Duration
+	// FailedByQuorum is set for closed proposals which haven't reached the quorum while the winning choice
+	// would have passed
+	FailedByQuorum bool
+}
+
+type QuorumStats struct {
+	Proposals           []*QuorumProposal
+	AvgTurnout          float64
+	ReachedQuorumShare  float64
+	FailedByQuorumShare float64
+	// MedianTimeToQuorum is nil if no proposal reached the quorum
+	MedianTimeToQuorum *time.Duration
+}
+
+type AuthorProposals struct {
+	Proposals     uint64
+	Finished      uint64
+	Succeeded     uint64
+	Spam          uint64
+	AvgVotes      float64
+	AvgVp         float64
+	FirstProposal time.Time
+	LastProposal  time.Time
+
+	// SuccessRate is succeeded divided by finished proposals, SpamRatio is spam divided by all proposals
+	SuccessRate float64
+	SpamRatio   float64
+}
+
+func (p *AuthorProposals) calculateRates() {
+	if p.Finished > 0 {
+		p.SuccessRate = float64(p.Succeeded) / float64(p.Finished)
+	}
+	if p.Proposals > 0 {
+		p.SpamRatio = float64(p.Spam) / float64(p.Proposals)
+	}
+}
+
+type DaoAuthor struct {
+	Author string
+	AuthorProposals
+}
+
+type AuthorDao struct {
+	DaoID uuid.UUID
+	AuthorProposals
+}
+
+type AppVotes struct {
+	PeriodStarted time.Time
+	App           string
+	Votes         uint64
+	Voters        uint64
+}
+
+type AppShare struct {
+	App    string
+	Votes  uint64
+	Voters uint64
+	// VotesShare is the share of votes of the app in the month, from 0 to 1
+	VotesShare float64
+}
+
+type MonthlyAppShare struct {
+	PeriodStarted       time.Time
+	Votes               uint64
+	Apps                []*AppShare
+	GoverlandVotesShare float64
+}
+
+type StrategyVp struct {
+	PeriodStarted time.Time
+	Strategy      string
+	Vp            float64
+}
+
+type StrategyShare struct {
+	Strategy string
+	Vp       float64
+	// Share is the share of vp of the strategy, from 0 to 1
+	Share float64
+}
+
+type MonthlyStrategyShare struct {
+	PeriodStarted time.Time
+	Vp            float64
+	Strategies    []*StrategyShare
+}
+
+type StrategyBreakdown struct {
+	// Total contains strategies for the whole period ordered by vp
+	Total   []*StrategyShare
+	History []*MonthlyStrategyShare
+}
+
+// RankKey is the sort key of the row in a ranked list, lists use only fields they are sorted by
+type RankKey struct {
+	Value float32   `json:"v,omitempty"`
+	Count uint64    `json:"c,omitempty"`
+	Time  time.Time `json:"t"`
+	ID    string    `json:"i"`
+}
+
+type RankedVoter struct {
+	VoterWithVp
+	LastVote time.Time
+}
+
+type RankedMutualDao struct {
+	DaoVoters
+	// RequestedDaoVoters is the number of voters of the requested dao
+	RequestedDaoVoters uint64
+}
+
+// Page is the page of a ranked list, NextCursor is empty on the last page
+type Page[T any] struct {
+	Items      []T
+	Total      uint64
+	NextCursor string
+}
+
 type Strategies []Strategy
 
 type Categories []string
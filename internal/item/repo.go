@@ -1,11 +1,45 @@
 package item
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// vpConcentrationMetrics calculates concentration metrics from vps: ascending sorted array of average vp of voters
+const vpConcentrationMetrics = `length(vps) as Voters,
+	arraySum(vps) as TotalVp,
+	if(TotalVp = 0, 0, 2 * arraySum(arrayMap((x, i) -> x * i, vps, arrayEnumerate(vps))) / (Voters * TotalVp) - (Voters + 1) / Voters) as Gini,
+	if(TotalVp = 0, 0, arrayFirstIndex(c -> c > TotalVp / 2, arrayCumSum(arrayReverse(vps)))) as Nakamoto,
+	if(TotalVp = 0, 0, arraySum(arrayMap(x -> pow(x / TotalVp, 2), vps))) as Hhi,
+	if(TotalVp = 0, 0, arraySum(arraySlice(arrayReverse(vps), 1, 10)) / TotalVp) as Top10Share`
+
+// activeDelegations selects delegate and delegator pairs of the dao whose last event is the delegation
+// without expiration or with due date in the future
+const activeDelegations = `select delegate, delegator
+	from delegations_raw
+	where dao_id = ?
+	group by delegate, delegator
+	having argMax(event_type, created_at) = 'core.delegates.created'
+		and (toUnixTimestamp(argMax(due_date, created_at)) = 0 or argMax(due_date, created_at) > now())`
+
+// authorProposalsMetrics aggregates proposals selected with author, state, spam, votes, scores_total and created columns
+const authorProposalsMetrics = `count() as Proposals,
+	countIf(state in ('succeeded', 'failed', 'defeated')) as Finished,
+	countIf(state = 'succeeded') as Succeeded,
+	countIf(spam) as Spam,
+	avgIf(votes, not spam) as AvgVotes,
+	avgIf(scores_total, not spam) as AvgVp,
+	min(created) as FirstProposal,
+	max(created) as LastProposal`
+
+// Repo reads votes_raw and proposals_raw with FINAL: the replacing merge tree collapses redelivered events
+// only on background merges, so aggregates would count them twice until then.
 type Repo struct {
 	db *gorm.DB
 }
@@ -14,12 +48,49 @@ func NewRepo(db *gorm.DB) *Repo {
 	return &Repo{db: db}
 }
 
-func (r *Repo) GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error) {
+type noQueryCacheKey struct{}
+
+// withoutQueryCache marks the context of queries whose results mustn't be read from or written to the clickhouse
+// query cache, e.g. loads of CachedProvider: its results are invalidated on storage commits, so reading them
+// from the query cache would return results older than the commit.
+func withoutQueryCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryCacheKey{}, true)
+}
+
+func queryCacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noQueryCacheKey{}).(bool)
+
+	return disabled
+}
+
+// query binds the query to the context. The driver cancels the query on the clickhouse side when the context
+// is done, max_execution_time stops it by the deadline on the server side in case the connection is lost.
+// Settings of the context don't override the SETTINGS clause of the query, so the query cache is disabled
+// by enable_* settings which queries don't set.
+func (r *Repo) query(ctx context.Context) *gorm.DB {
+	settings := clickhouse.Settings{
+		// raw tables are partitioned by month and duplicates are in the same partition, so FINAL merges
+		// partitions independently and skips merged ones
+		"do_not_merge_across_partitions_select_final": 1,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		settings["max_execution_time"] = max(int(math.Ceil(time.Until(deadline).Seconds())), 1)
+	}
+	if queryCacheDisabled(ctx) {
+		settings["enable_reads_from_query_cache"] = 0
+		settings["enable_writes_to_query_cache"] = 0
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+
+	return r.db.WithContext(ctx)
+}
+
+func (r *Repo) GetMonthlyActiveUsersByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error) {
 	var au, nau []*MonthlyUser
 	var err error
 	if period == 1 {
-		var err = r.db.Raw(`SELECT toStartOfDay(created_at) as PeriodStarted, uniq(voter) as ActiveUsers
-								FROM votes_raw where dao_id = ? and PeriodStarted > date_sub(MONTH, 1, toStartOfDay(today()))
+		var err = r.query(ctx).Raw(`SELECT toStartOfDay(created_at) as PeriodStarted, uniq(voter) as ActiveUsers
+								FROM votes_raw FINAL where dao_id = ? and PeriodStarted > date_sub(MONTH, 1, toStartOfDay(today()))
 								GROUP BY PeriodStarted
 								ORDER BY PeriodStarted
 								WITH FILL FROM date_sub(MONTH, 1, toStartOfDay(today())) TO date_add(DAY, 1, toStartOfDay(today())) STEP INTERVAL 1 DAY
@@ -30,7 +101,7 @@ func (r *Repo) GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*Mon
 			return nil, err
 		}
 
-		err = r.db.Raw(`SELECT PeriodStarted, uniqExact(voter) AS ActiveUsers
+		err = r.query(ctx).Raw(`SELECT PeriodStarted, uniqExact(voter) AS ActiveUsers
 							FROM (SELECT toStartOfDay(minMerge(start_date)) as PeriodStarted, voter from dao_voters_start_mv WHERE dao_id = ? group by dao_id, voter) dv
 							WHERE PeriodStarted > date_sub(MONTH, 1, toStartOfDay(today())) GROUP BY PeriodStarted
 							ORDER BY PeriodStarted
@@ -51,7 +122,7 @@ func (r *Repo) GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*Mon
 			ft = fmt.Sprintf("FROM date_sub(MONTH, %d, toStartOfMonth(today())) TO date_add(MONTH, 1, toStartOfMonth(today()))", period-1)
 		}
 
-		var err = r.db.Raw(`SELECT month_start AS PeriodStarted,
+		var err = r.query(ctx).Raw(`SELECT month_start AS PeriodStarted,
        							   uniqExactMerge(voters_count) AS ActiveUsers
 							 FROM dao_voters_count
 								WHERE dao_id = ?`+pc+`
@@ -65,7 +136,7 @@ func (r *Repo) GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*Mon
 			return nil, err
 		}
 
-		err = r.db.Raw(`SELECT PeriodStarted,
+		err = r.query(ctx).Raw(`SELECT PeriodStarted,
 							   uniqExact(voter) AS ActiveUsers
 						FROM (SELECT toStartOfMonth(minMerge(start_date)) as PeriodStarted, voter from dao_voters_start_mv WHERE dao_id = ? group by dao_id, voter) dv
 						`+wpc+`GROUP BY PeriodStarted
@@ -96,14 +167,14 @@ func (r *Repo) GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*Mon
 	return res, err
 }
 
-func (r *Repo) GetVoterBucketsByDaoId(id uuid.UUID) ([]*Bucket, error) {
+func (r *Repo) GetVoterBucketsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
 	var res []*Bucket
-	err := r.db.Raw(`
+	err := r.query(ctx).Raw(`
 		SELECT GroupId,
 		       count() AS Voters
 		FROM (
 		    SELECT uniq(proposal_id) AS bucket
-		    FROM votes_raw
+		    FROM votes_raw FINAL
 		    WHERE dao_id = ?
 		    GROUP BY voter
 		) AS votes_count
@@ -117,14 +188,14 @@ func (r *Repo) GetVoterBucketsByDaoId(id uuid.UUID) ([]*Bucket, error) {
 	return res, err
 }
 
-func (r *Repo) GetVotesGroupsByDaoId(id uuid.UUID) ([]*Bucket, error) {
+func (r *Repo) GetVotesGroupsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
 	var res []*Bucket
-	err := r.db.Raw(`
+	err := r.query(ctx).Raw(`
 		SELECT GroupId,
 		       count() AS Voters
 		FROM (
 		    SELECT uniq(proposal_id) AS GroupId
-		    FROM votes_raw
+		    FROM votes_raw FINAL
 		    WHERE dao_id = ?
 		    GROUP BY voter
 		) AS votes_count
@@ -137,9 +208,9 @@ func (r *Repo) GetVotesGroupsByDaoId(id uuid.UUID) ([]*Bucket, error) {
 	return res, err
 }
 
-func (r *Repo) GetExclusiveVotersByDaoId(id uuid.UUID) (*ExclusiveVoters, error) {
+func (r *Repo) GetExclusiveVotersByDaoId(ctx context.Context, id uuid.UUID) (*ExclusiveVoters, error) {
 	var res *ExclusiveVoters
-	err := r.db.Raw(`
+	err := r.query(ctx).Raw(`
 		SELECT countIf(daoCount = 1) as Exclusive,
 		       count() as Total
 		FROM (
@@ -154,15 +225,15 @@ func (r *Repo) GetExclusiveVotersByDaoId(id uuid.UUID) (*ExclusiveVoters, error)
 	return res, err
 }
 
-func (r *Repo) GetMonthlyNewProposalsByDaoId(id uuid.UUID, period uint32) ([]*ProposalsByMonth, error) {
+func (r *Repo) GetMonthlyNewProposalsByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*ProposalsByMonth, error) {
 	var res []*ProposalsByMonth
 	var err error
 	if period == 1 {
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 		SELECT toStartOfDay(created_at) AS PeriodStarted,
 		       uniq(proposal_id) AS ProposalsCount,
 		       uniqIf(proposal_id, spam=true) AS SpamCount
-		FROM proposals_raw 
+		FROM proposals_raw FINAL 
 		WHERE dao_id = ? and created_at >= date_sub(MONTH, 1, toStartOfDay(today()))
 		GROUP BY PeriodStarted
 		ORDER BY PeriodStarted
@@ -175,11 +246,11 @@ func (r *Repo) GetMonthlyNewProposalsByDaoId(id uuid.UUID, period uint32) ([]*Pr
 			ft = fmt.Sprintf("FROM date_sub(MONTH, %d, toStartOfMonth(today())) TO date_add(MONTH, 1, toStartOfMonth(today()))", period-1)
 		}
 
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 		SELECT toStartOfMonth(created_at) AS PeriodStarted,
 		       uniq(proposal_id) AS ProposalsCount,
 		       uniqIf(proposal_id, spam=true) AS SpamCount
-		FROM proposals_raw 
+		FROM proposals_raw FINAL 
 		WHERE dao_id = ? and (0 = ? or PeriodStarted > date_sub(MONTH, ?, toStartOfMonth(today())))
 		GROUP BY PeriodStarted
 		ORDER BY PeriodStarted
@@ -191,12 +262,12 @@ func (r *Repo) GetMonthlyNewProposalsByDaoId(id uuid.UUID, period uint32) ([]*Pr
 	return res, err
 }
 
-func (r *Repo) GetProposalsCountByDaoId(id uuid.UUID) (*FinalProposalCounts, error) {
+func (r *Repo) GetProposalsCountByDaoId(ctx context.Context, id uuid.UUID) (*FinalProposalCounts, error) {
 	var res *FinalProposalCounts
-	err := r.db.Raw(`select countIf(status='succeeded') as Succeeded, count() as Finished 
+	err := r.query(ctx).Raw(`select countIf(status='succeeded') as Succeeded, count() as Finished 
 							from (
 								select argMax(state, created_at) as status
-								from proposals_raw
+								from proposals_raw final
 								where dao_id = ? and state in ('succeeded', 'failed', 'defeated')
 								group by proposal_id)`, id).
 		Scan(&res).
@@ -204,28 +275,13 @@ func (r *Repo) GetProposalsCountByDaoId(id uuid.UUID) (*FinalProposalCounts, err
 	return res, err
 }
 
-func (r *Repo) GetMutualDaos(id uuid.UUID, limit uint64) ([]*DaoVoters, error) {
-	var res []*DaoVoters
-	err := r.db.Raw(`
-		select dao_id as DaoID, uniq(voter) as VotersCount from dao_voters_start_mv 
-		    where voter in (select voter from dao_voters_start_mv where dao_id = ?)
-				group by dao_id 
-				order by multiIf(dao_id = ?, 1,2), VotersCount desc 
-				Limit ?  
-				SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 21600`, id, id, limit).
-		Scan(&res).
-		Error
-
-	return res, err
-}
-
-func (r *Repo) GetTopVotersByVp(id uuid.UUID, offset int, limit int, period uint32) ([]*VoterWithVp, error) {
+func (r *Repo) GetTopVotersByVp(ctx context.Context, id uuid.UUID, offset int, limit int, period uint32) ([]*VoterWithVp, error) {
 	var res []*VoterWithVp
 	var err error
 	if period == 0 {
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 		select voter as Voter, avg(vp) as VpAvg, uniq(proposal_id) as VotesCount 
-			from votes_raw 
+			from votes_raw final 
 				where dao_id = ?
 		        group by voter 
 		        order by (VpAvg, VotesCount, max(created_at)) desc limit ? offset ?
@@ -234,9 +290,9 @@ func (r *Repo) GetTopVotersByVp(id uuid.UUID, offset int, limit int, period uint
 			Scan(&res).
 			Error
 	} else {
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 		select voter as Voter, avg(vp) as VpAvg, uniq(proposal_id) as VotesCount 
-			from votes_raw 
+			from votes_raw final 
 				where dao_id = ? and created_at >= date_sub(MONTH, ?, today())
 		        group by voter 
 		        order by (VpAvg, VotesCount, max(created_at)) desc limit ? offset ?
@@ -249,13 +305,13 @@ func (r *Repo) GetTopVotersByVp(id uuid.UUID, offset int, limit int, period uint
 	return res, err
 }
 
-func (r *Repo) GetTotalVpAvgForActiveVoters(id uuid.UUID, period uint32) (*VpAvgTotal, error) {
+func (r *Repo) GetTotalVpAvgForActiveVoters(ctx context.Context, id uuid.UUID, period uint32) (*VpAvgTotal, error) {
 	var res *VpAvgTotal
 	var err error
 	if period == 0 {
-		err = r.db.Raw(`select sum(VpAvg) as VpAvgs, uniq(Voter) as Voters from
+		err = r.query(ctx).Raw(`select sum(VpAvg) as VpAvgs, uniq(Voter) as Voters from
                                    (select voter as Voter, avg(vp) as VpAvg
-                        			from votes_raw
+                        			from votes_raw final
                         			where dao_id = ?
                         			group by voter) 
 		        SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
@@ -263,9 +319,9 @@ func (r *Repo) GetTotalVpAvgForActiveVoters(id uuid.UUID, period uint32) (*VpAvg
 			Scan(&res).
 			Error
 	} else {
-		err = r.db.Raw(`select sum(VpAvg) as VpAvgs, uniq(Voter) as Voters from
+		err = r.query(ctx).Raw(`select sum(VpAvg) as VpAvgs, uniq(Voter) as Voters from
                                    (select voter as Voter, avg(vp) as VpAvg
-                        			from votes_raw
+                        			from votes_raw final
                         			where dao_id = ? and created_at >= date_sub(MONTH, ?, today())
                         			group by voter) 
 		        SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
@@ -277,22 +333,22 @@ func (r *Repo) GetTotalVpAvgForActiveVoters(id uuid.UUID, period uint32) (*VpAvg
 	return res, err
 }
 
-func (r *Repo) GetVpAvgList(id uuid.UUID, period uint32, price float32) ([]float32, error) {
+func (r *Repo) GetVpAvgList(ctx context.Context, id uuid.UUID, period uint32, price float32) ([]float32, error) {
 	var res []float32
 	var err error
 	if period == 0 {
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 							select avg(vp) * ? as VpAvg
-							from votes_raw
+							from votes_raw final
 							where dao_id = ?
 							group by voter order by VpAvg
 		        SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200`, price, id).
 			Scan(&res).
 			Error
 	} else {
-		err = r.db.Raw(`
+		err = r.query(ctx).Raw(`
 		select avg(vp) * ? as VpAvg
-			from votes_raw 
+			from votes_raw final 
 				where dao_id = ? and created_at >= date_sub(MONTH, ?, today())
 		        group by voter order by VpAvg
 		        SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
@@ -303,49 +359,73 @@ func (r *Repo) GetVpAvgList(id uuid.UUID, period uint32, price float32) ([]float
 	return res, err
 }
 
-func (r *Repo) GetVoterTotalsForPeriods(periodInDays uint32) (*VoterTotals, error) {
-	var res *VoterTotals
-	err := r.db.Raw(`select uniqIf(voter, dateDiff('day', created_at, today()) <= ?) as VoterTotal,
+const (
+	voterTotalsForPeriodsQuery = `select uniqIf(voter, dateDiff('day', created_at, today()) <= ?) as VoterTotal,
 						     	uniqIf(voter, dateDiff('day', created_at, today()) > ?) as VoterTotalPrevPeriod,
 						     	uniqIf((voter, proposal_id), dateDiff('day', created_at, today()) <= ?) as VotesTotal,
 							    uniqIf((voter, proposal_id), dateDiff('day', created_at, today()) > ?) as VotesTotalPrevPeriod
-						 from votes_raw 
-						 	where dateDiff('day', created_at, today()) <= ? and created_at <= today()
+						 from votes_raw final 
+						 	where dateDiff('day', created_at, today()) <= ? and created_at <= today()`
+
+	daoProposalTotalsForPeriodsQuery = `select uniqIf(dao_id, dateDiff('day', created_at, today()) <= ?) as DaoTotal,
+						     	uniqIf(dao_id, dateDiff('day', created_at, today()) > ?) as DaoTotalPrevPeriod,
+						     	uniqIf(proposal_id, dateDiff('day', created_at, today()) <= ?) as ProposalTotal,
+							    uniqIf(proposal_id, dateDiff('day', created_at, today()) > ?) as ProposalTotalPrevPeriod
+						 from proposals_raw final 
+						 	where dateDiff('day', created_at, today()) <= ?`
+
+	totalsForPeriodsCacheSettings = `
     					 SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
-    						query_cache_store_results_of_queries_with_nondeterministic_functions = true`, periodInDays, periodInDays, periodInDays, periodInDays, 2*periodInDays).
+    						query_cache_store_results_of_queries_with_nondeterministic_functions = true`
+)
+
+func (r *Repo) GetVoterTotalsForPeriods(ctx context.Context, periodInDays uint32) (*VoterTotals, error) {
+	return r.voterTotalsForPeriods(ctx, voterTotalsForPeriodsQuery+totalsForPeriodsCacheSettings, periodInDays)
+}
+
+// GetCurrentVoterTotalsForPeriods is GetVoterTotalsForPeriods bypassing the query cache
+func (r *Repo) GetCurrentVoterTotalsForPeriods(ctx context.Context, periodInDays uint32) (*VoterTotals, error) {
+	return r.voterTotalsForPeriods(ctx, voterTotalsForPeriodsQuery, periodInDays)
+}
+
+func (r *Repo) voterTotalsForPeriods(ctx context.Context, query string, periodInDays uint32) (*VoterTotals, error) {
+	var res *VoterTotals
+	err := r.query(ctx).Raw(query, periodInDays, periodInDays, periodInDays, periodInDays, 2*periodInDays).
 		Scan(&res).
 		Error
 
 	return res, err
 }
 
-func (r *Repo) GetDaoProposalTotalsForPeriods(periodInDays uint32) (*ActiveDaoProposalTotals, error) {
+func (r *Repo) GetDaoProposalTotalsForPeriods(ctx context.Context, periodInDays uint32) (*ActiveDaoProposalTotals, error) {
+	return r.daoProposalTotalsForPeriods(ctx, daoProposalTotalsForPeriodsQuery+totalsForPeriodsCacheSettings, periodInDays)
+}
+
+// GetCurrentDaoProposalTotalsForPeriods is GetDaoProposalTotalsForPeriods bypassing the query cache
+func (r *Repo) GetCurrentDaoProposalTotalsForPeriods(ctx context.Context, periodInDays uint32) (*ActiveDaoProposalTotals, error) {
+	return r.daoProposalTotalsForPeriods(ctx, daoProposalTotalsForPeriodsQuery, periodInDays)
+}
+
+func (r *Repo) daoProposalTotalsForPeriods(ctx context.Context, query string, periodInDays uint32) (*ActiveDaoProposalTotals, error) {
 	var res *ActiveDaoProposalTotals
-	err := r.db.Raw(`select uniqIf(dao_id, dateDiff('day', created_at, today()) <= ?) as DaoTotal,
-						     	uniqIf(dao_id, dateDiff('day', created_at, today()) > ?) as DaoTotalPrevPeriod,
-						     	uniqIf(proposal_id, dateDiff('day', created_at, today()) <= ?) as ProposalTotal,
-							    uniqIf(proposal_id, dateDiff('day', created_at, today()) > ?) as ProposalTotalPrevPeriod
-						 from proposals_raw 
-						 	where dateDiff('day', created_at, today()) <= ?
-    					 SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
-    						query_cache_store_results_of_queries_with_nondeterministic_functions = true`, periodInDays, periodInDays, periodInDays, periodInDays, 2*periodInDays).
+	err := r.query(ctx).Raw(query, periodInDays, periodInDays, periodInDays, periodInDays, 2*periodInDays).
 		Scan(&res).
 		Error
 
 	return res, err
 }
 
-func (r *Repo) GetMonthlyDaos() ([]*MonthlyTotal, error) {
+func (r *Repo) GetMonthlyDaos(ctx context.Context) ([]*MonthlyTotal, error) {
 	var res []*MonthlyTotal
 
-	var err = r.db.Raw(`select toStartOfMonth(p.created_at) AS PeriodStarted,
+	var err = r.query(ctx).Raw(`select toStartOfMonth(p.created_at) AS PeriodStarted,
 		       					   uniq(p.dao_id) AS Total,
 		       					   uniqIf(p.dao_id, p.created_at = firstProposalTime) AS TotalOfNew
-							FROM proposals_raw p
+							FROM proposals_raw p FINAL
 								INNER JOIN (
 									SELECT min(created_at) AS firstProposalTime,
 										   dao_id
-									FROM proposals_raw
+									FROM proposals_raw FINAL
 									GROUP BY dao_id
 								) first_proposals ON p.dao_id = first_proposals.dao_id
 							GROUP BY PeriodStarted
@@ -360,11 +440,11 @@ func (r *Repo) GetMonthlyDaos() ([]*MonthlyTotal, error) {
 	return res, err
 }
 
-func (r *Repo) GetMonthlyProposals() ([]*MonthlyTotal, error) {
+func (r *Repo) GetMonthlyProposals(ctx context.Context) ([]*MonthlyTotal, error) {
 	var res []*MonthlyTotal
-	err := r.db.Raw(`SELECT toStartOfMonth(created_at) AS PeriodStarted,
+	err := r.query(ctx).Raw(`SELECT toStartOfMonth(created_at) AS PeriodStarted,
        							uniq(proposal_id) AS Total
-						  FROM proposals_raw
+						  FROM proposals_raw FINAL
 							GROUP BY PeriodStarted
 							ORDER BY PeriodStarted
 							WITH FILL STEP INTERVAL 1 MONTH`).
@@ -374,10 +454,10 @@ func (r *Repo) GetMonthlyProposals() ([]*MonthlyTotal, error) {
 	return res, err
 }
 
-func (r *Repo) GetMonthlyVoters() ([]*MonthlyTotal, error) {
+func (r *Repo) GetMonthlyVoters(ctx context.Context) ([]*MonthlyTotal, error) {
 	var au, nau []*MonthlyUser
 
-	var err = r.db.Raw(`SELECT month_start AS PeriodStarted,
+	var err = r.query(ctx).Raw(`SELECT month_start AS PeriodStarted,
        							   uniqMerge(voters_count) AS ActiveUsers
 							 FROM voters_monthly_count_mv
 								GROUP BY PeriodStarted
@@ -390,7 +470,7 @@ func (r *Repo) GetMonthlyVoters() ([]*MonthlyTotal, error) {
 		return nil, err
 	}
 
-	err = r.db.Raw(`SELECT PeriodStarted,
+	err = r.query(ctx).Raw(`SELECT PeriodStarted,
 							   uniq(voter) AS ActiveUsers
 						FROM (SELECT toStartOfMonth(minMerge(start_date)) as PeriodStarted, voter from voters_start_mv group by voter) dv
 						GROUP BY PeriodStarted
@@ -420,29 +500,29 @@ func (r *Repo) GetMonthlyVoters() ([]*MonthlyTotal, error) {
 	return res, err
 }
 
-func (r *Repo) GetDaoProposalForPeriod(period uint8) (map[uuid.UUID]float64, error) {
+func (r *Repo) GetDaoProposalForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error) {
 	var res []*TotalForDaos
-	err := r.db.Raw(`select dao_id as DaoID, uniq(proposal_id) as Total 
-					     	from proposals_raw 
+	err := r.query(ctx).Raw(`select dao_id as DaoID, uniq(proposal_id) as Total 
+					     	from proposals_raw final 
 						  		where event_type = 'core.proposal.created' and dateDiff('day', created_day, today()) <= ? and created_day <= today()
-                                            and proposal_id in (select proposal_id from votes_raw group by proposal_id having uniq(voter) >= 5) group by dao_id`, period).
+                                            and proposal_id in (select proposal_id from votes_raw final group by proposal_id having uniq(voter) >= 5) group by dao_id`, period).
 		Scan(&res).
 		Error
 
 	return convertResultToMap(res), err
 }
 
-func (r *Repo) GetDaoVotersForPeriod(period uint8) (map[uuid.UUID]float64, error) {
+func (r *Repo) GetDaoVotersForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error) {
 	var res []*TotalForDaos
 	var err error
 	if period == 0 {
-		err = r.db.Raw(`select dao_id as DaoID, uniq(voter) as Total 
-							from votes_raw group by dao_id`).
+		err = r.query(ctx).Raw(`select dao_id as DaoID, uniq(voter) as Total 
+							from votes_raw final group by dao_id`).
 			Scan(&res).
 			Error
 	} else {
-		err = r.db.Raw(`select dao_id as DaoID, uniq(voter) as Total 
-							from votes_raw
+		err = r.query(ctx).Raw(`select dao_id as DaoID, uniq(voter) as Total 
+							from votes_raw final
 								where dateDiff('day', created_day, today())<=? group by dao_id`, period).
 			Scan(&res).
 			Error
@@ -450,17 +530,17 @@ func (r *Repo) GetDaoVotersForPeriod(period uint8) (map[uuid.UUID]float64, error
 	return convertResultToMap(res), err
 }
 
-func (r *Repo) GetDaoVotesForPeriod(period uint8) (map[uuid.UUID]float64, error) {
+func (r *Repo) GetDaoVotesForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error) {
 	var res []*TotalForDaos
 	var err error
 	if period == 0 {
-		err = r.db.Raw(`select dao_id as DaoID, uniq(voter, proposal_id) as Total 
-							from votes_raw group by dao_id`).
+		err = r.query(ctx).Raw(`select dao_id as DaoID, uniq(voter, proposal_id) as Total 
+							from votes_raw final group by dao_id`).
 			Scan(&res).
 			Error
 	} else {
-		err = r.db.Raw(`select dao_id as DaoID, uniq(voter, proposal_id) as Total 
-							from votes_raw
+		err = r.query(ctx).Raw(`select dao_id as DaoID, uniq(voter, proposal_id) as Total 
+							from votes_raw final
 								where dateDiff('day', created_day, today())<=? group by dao_id`, period).
 			Scan(&res).
 			Error
@@ -469,19 +549,19 @@ func (r *Repo) GetDaoVotesForPeriod(period uint8) (map[uuid.UUID]float64, error)
 	return convertResultToMap(res), err
 }
 
-func (r *Repo) GetDaos() ([]uuid.UUID, error) {
+func (r *Repo) GetDaos(ctx context.Context) ([]uuid.UUID, error) {
 	var res []uuid.UUID
-	err := r.db.Raw(`select distinct dao_id from daos_raw`).
+	err := r.query(ctx).Raw(`select distinct dao_id from daos_raw`).
 		Scan(&res).
 		Error
 
 	return res, err
 }
 
-func (r *Repo) GetGoverlandIndexAdditives() (map[uuid.UUID]float64, error) {
+func (r *Repo) GetGoverlandIndexAdditives(ctx context.Context) (map[uuid.UUID]float64, error) {
 	var res []*TotalForDaos
 	var err error
-	err = r.db.Raw(`select dao_id as DaoID, argMax(additive, start_at) as Total 
+	err = r.query(ctx).Raw(`select dao_id as DaoID, argMax(additive, start_at) as Total 
 							from goverland_index_additive
 								where start_at<=today() and (finish_at>=today() or finish_at is null)
 								group by dao_id`).
@@ -490,10 +570,10 @@ func (r *Repo) GetGoverlandIndexAdditives() (map[uuid.UUID]float64, error) {
 	return convertResultToMap(res), err
 }
 
-func (r *Repo) GetTokenPrice(id uuid.UUID) (float32, error) {
+func (r *Repo) GetTokenPrice(ctx context.Context, id uuid.UUID) (float32, error) {
 	var res float32
 	var err error
-	err = r.db.Raw(`select argMax(price, created_day) 
+	err = r.query(ctx).Raw(`select argMax(price, created_day) 
 							from token_price
 								where dao_id = ?`, id).
 		Scan(&res).
@@ -501,38 +581,417 @@ func (r *Repo) GetTokenPrice(id uuid.UUID) (float32, error) {
 	return res, err
 }
 
-func (r *Repo) GetTopDaos(category string, interval string, pricePeriod string) ([]*TopDao, error) {
-	var res []*TopDao
-	i, ok := Intervals[interval]
-	if !ok {
-		i = 1
+func (r *Repo) GetProposalInfo(ctx context.Context, proposalID string) (*ProposalInfo, error) {
+	var res []*ProposalInfo
+	err := r.query(ctx).Raw(`select argMax(dao_id, event_time) as DaoID, argMax(start, event_time) as Start,
+							argMax("end", event_time) as End, argMax(quorum, event_time) as Quorum
+						from proposals_raw final
+							where proposal_id = ?
+							group by proposal_id`, proposalID).
+		Scan(&res).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
-	err := r.db.Raw(`with tokens as (
-    						select dao_id, max(created_at) as period_end, argMax(price, created_at) as current_price, 
-								   min(created_day) as period_start, argMin(price, created_at) as period_start_price
-    						from token_price where created_at <= now() and created_at >= multiIf(?='1W', date_sub(WEEK, 1, now()), ?='1M', date_sub(MONTH, 1, now()), date_sub(HOUR, 24, now()))
-							and dao_id in (select dao_id from (select w.dao_id, argMax(w.disabled, w.created_at) as disabled from whitelist w where w.feature_type='TOP' group by w.dao_id) s where s.disabled = false) 
-							and multiIf('new'=?, dao_id in (select distinct dao_id from daos_raw where event_type='dao_created' and created_day >= date_sub(MONTH , 3, today())), 
-												 dao_id not in (select distinct dao_id from daos_raw where event_type='dao_created' and created_day >= date_sub(MONTH , 3, today())))
+
+	return res[0], nil
+}
+
+// GetProposalVotesTimeline returns voters and their vp by the hour of the first vote, the last vote of the voter is taken for vp
+func (r *Repo) GetProposalVotesTimeline(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalVotesBucket, error) {
+	var res []*ProposalVotesBucket
+	err := r.query(ctx).Raw(`select toStartOfHour(first_vote) as PeriodStarted, count() as Voters, sum(vp) as Vp
+						from (select voter, min(created_at) as first_vote, argMax(vp, created_at) as vp
+							  from votes_raw final
+							  where dao_id = ? and proposal_id = ?
+							  group by voter)
+						group by PeriodStarted
+						order by PeriodStarted
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, daoID, proposalID).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetProposalChoices(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalChoice, error) {
+	var res []*ProposalChoice
+	err := r.query(ctx).Raw(`select choice as Choice, count() as Voters, sum(vp) as Vp
+						from (select voter, argMax(choice, created_at) as choice, argMax(vp, created_at) as vp
+							  from votes_raw final
+							  where dao_id = ? and proposal_id = ?
+							  group by voter)
+						group by choice
+						order by Vp desc
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, daoID, proposalID).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetProposalVpTotals(ctx context.Context, daoID uuid.UUID, proposalID string, finalPeriodFrom time.Time, quorum float64) (*ProposalVpTotals, error) {
+	var res *ProposalVpTotals
+	err := r.query(ctx).Raw(`with voters as (
+							select voter, min(created_at) as first_vote, argMax(vp, created_at) as vp
+							from votes_raw final
+							where dao_id = ? and proposal_id = ?
+							group by voter
+						)
+						select sum(vp) as Vp,
+							   sumIf(vp, first_vote >= ?) as FinalPeriodVp,
+							   (select minOrNull(first_vote)
+									from (select first_vote, sum(vp) over (order by first_vote, voter rows between unbounded preceding and current row) as cumulative_vp
+										  from voters)
+									where cumulative_vp >= ?) as QuorumReachedAt
+						from voters`, daoID, proposalID, finalPeriodFrom, quorum).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetVoterDaos(ctx context.Context, voter string) ([]*VoterDao, error) {
+	var res []*VoterDao
+	err := r.query(ctx).Raw(`with voter_daos as (
+							select dao_id, min(created_at) as first_vote, max(created_at) as last_vote,
+								   uniq(proposal_id) as votes, avg(vp) as vp_avg
+							from votes_raw final
+							where dao_id in (select dao_id from dao_voters_start_mv where voter = ?) and voter = ?
 							group by dao_id
-							),
-     						  proposals as (
-         					select p.dao_id, proposal_id, argMax(scores_total, event_time) as vp, argMax(votes, event_time) as voters,
-							argMax(spam, event_time) as spam, argMax(state, event_time) as state
-							from proposals_raw p where
-								 p.dao_id in (select distinct t.dao_id from tokens t where period_end >= date_sub(DAY, 1, now())) and
-								 toDateTime("end") <= today() and toDateTime("end") >= multiIf(?=0, date_sub(WEEK, 1, today()), date_sub(MONTH, ?, today()))  
-							group by p.dao_id, proposal_id
-     						)
-						select rowNumberInAllBlocks() + 1 as Index, p.dao_id as DaoID, sum(p.voters) as Voters, uniq(p.proposal_id) as Proposals,
-							   sum(p.vp)/Proposals as AvpToken, max(t.current_price) * AvpToken as AvpUsd, max(t.current_price) as TokenPrice,
-							   multiIf(max(t.period_start_price) = 0, 0, (TokenPrice - max(t.period_start_price)) / max(t.period_start_price)) as TokenPriceChange
-						from proposals p 
-						inner join tokens t on t.dao_id = p.dao_id
-						where p.spam != true and p.state != 'canceled'
-						group by p.dao_id order by AvpUsd desc
+						),
+						proposals as (
+							select dao_id, proposal_id, argMax("end", event_time) as end_at, argMax(spam, event_time) as spam
+							from proposals_raw final
+							where dao_id in (select dao_id from voter_daos)
+							group by dao_id, proposal_id
+						)
+						select v.dao_id as DaoID, any(v.first_vote) as FirstVote, any(v.last_vote) as LastVote,
+							   any(v.votes) as Votes, any(v.vp_avg) as VpAvg,
+							   uniqIf(p.proposal_id, p.spam = false and toDateTime(p.end_at) >= v.first_vote) as Proposals
+						from voter_daos v
+							left join proposals p on p.dao_id = v.dao_id
+						group by v.dao_id
+						order by LastVote desc
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, voter, voter).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetVoterMonthlyActivity(ctx context.Context, voter string) ([]*VoterMonthlyActivity, error) {
+	var res []*VoterMonthlyActivity
+	err := r.query(ctx).Raw(`select toStartOfMonth(created_at) as PeriodStarted, uniq(dao_id, proposal_id) as Votes, uniq(dao_id) as Daos
+						from votes_raw final
+							where dao_id in (select dao_id from dao_voters_start_mv where voter = ?) and voter = ?
+						group by PeriodStarted
+						order by PeriodStarted
+						WITH FILL STEP INTERVAL 1 MONTH
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, voter, voter).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetVoterRetention returns the number of voters of each first vote month (cohort) active in each later month
+func (r *Repo) GetVoterRetention(ctx context.Context, id uuid.UUID, months uint32) ([]*RetentionCell, error) {
+	var res []*RetentionCell
+	err := r.query(ctx).Raw(`with cohorts as (
+							select voter, toStartOfMonth(minMerge(start_date)) as cohort
+							from dao_voters_start_mv
+							where dao_id = ?
+							group by voter
+							having 0 = ? or cohort > date_sub(MONTH, ?, toStartOfMonth(today()))
+						)
+						select c.cohort as Cohort, a.month as PeriodStarted, count() as Voters
+						from (select distinct voter, toStartOfMonth(created_at) as month
+							  from votes_raw final
+							  where dao_id = ? and (0 = ? or created_at > date_sub(MONTH, ?, toStartOfMonth(today())))) a
+							inner join cohorts c on c.voter = a.voter
+						group by Cohort, PeriodStarted
+						order by Cohort, PeriodStarted
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200`, id, months, months, id, months, months).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetVpConcentration(ctx context.Context, id uuid.UUID, period uint32) (*VpConcentration, error) {
+	var res *VpConcentration
+	err := r.query(ctx).Raw(`select `+vpConcentrationMetrics+`
+						from (select arraySort(groupArray(vp_avg)) as vps
+							  from (select voter, avg(vp) as vp_avg
+									from votes_raw final
+									where dao_id = ? and (0 = ? or created_at >= date_sub(MONTH, ?, today()))
+									group by voter))
 						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
-    						query_cache_store_results_of_queries_with_nondeterministic_functions = true`, pricePeriod, pricePeriod, category, i, i).
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, period, period).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetMonthlyVpConcentration returns concentration metrics by average vp of voters in each month
+func (r *Repo) GetMonthlyVpConcentration(ctx context.Context, id uuid.UUID, period uint32) ([]*VpConcentration, error) {
+	var res []*VpConcentration
+	err := r.query(ctx).Raw(`select PeriodStarted, `+vpConcentrationMetrics+`
+						from (select month as PeriodStarted, arraySort(groupArray(vp_avg)) as vps
+							  from (select toStartOfMonth(created_at) as month, voter, avg(vp) as vp_avg
+									from votes_raw final
+									where dao_id = ? and (0 = ? or created_at >= date_sub(MONTH, ?, toStartOfMonth(today())))
+									group by month, voter)
+							  group by month)
+						order by PeriodStarted
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, period, period).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetProposalOutcomes returns winners of finished proposals of the dao with and without votes of the top voters by vp.
+// Only single choice votes are taken into account, winner is empty if there are no votes left.
+func (r *Repo) GetProposalOutcomes(ctx context.Context, id uuid.UUID) ([]*ProposalOutcome, error) {
+	var res []*ProposalOutcome
+	err := r.query(ctx).Raw(`with voters as (
+							select proposal_id, voter, argMax(choice, created_at) as choice, argMax(vp, created_at) as vp
+							from votes_raw final
+							where dao_id = ?
+							group by proposal_id, voter
+							having match(choice, '^[0-9]+$')
+						),
+						ranked as (
+							select proposal_id, choice, vp, row_number() over (partition by proposal_id order by vp desc, voter) as rank
+							from voters
+						),
+						choices as (
+							select proposal_id, choice, sum(vp) as vp, sumIf(vp, rank > 1) as vp_without_top1, sumIf(vp, rank > 3) as vp_without_top3
+							from ranked
+							group by proposal_id, choice
+						),
+						proposals as (
+							select proposal_id, argMax("end", event_time) as end_at, argMax(spam, event_time) as spam, argMax(state, event_time) as state
+							from proposals_raw final
+							where dao_id = ?
+							group by proposal_id
+						)
+						select c.proposal_id as ProposalID, toDateTime(any(p.end_at)) as EndAt,
+							   argMax(c.choice, c.vp) as Winner,
+							   if(sum(c.vp_without_top1) = 0, '', argMax(c.choice, c.vp_without_top1)) as WinnerWithoutTop1,
+							   if(sum(c.vp_without_top3) = 0, '', argMax(c.choice, c.vp_without_top3)) as WinnerWithoutTop3
+						from choices c
+							inner join proposals p on p.proposal_id = c.proposal_id
+						where p.spam = false and p.state != 'canceled' and toDateTime(p.end_at) <= now()
+						group by c.proposal_id
+						order by EndAt
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, id).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetTopDelegates(ctx context.Context, id uuid.UUID, limit int, offset int) ([]*Delegate, error) {
+	var res []*Delegate
+	err := r.query(ctx).Raw(`with active as (`+activeDelegations+`),
+						delegates_vp as (
+							select voter, avg(vp) as vp_avg, uniq(proposal_id) as votes
+							from votes_raw final
+							where dao_id = ? and voter in (select delegate from active)
+							group by voter
+						)
+						select a.delegate as Delegate, count() as Delegators, any(v.vp_avg) as VpAvg, any(v.votes) as VotesCount
+						from active a
+							left join delegates_vp v on v.voter = a.delegate
+						group by a.delegate
+						order by Delegators desc, VpAvg desc, Delegate
+						limit ? offset ?
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, id, limit, offset).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetDelegatedVp returns the vp of voters given by delegation strategies, vp_by_strategy follows the order of
+// strategies of the proposal
+func (r *Repo) GetDelegatedVp(ctx context.Context, id uuid.UUID, period uint32) (*DelegatedVp, error) {
+	var res *DelegatedVp
+	err := r.query(ctx).Raw(`with active as (`+activeDelegations+`),
+						proposals as (
+							select proposal_id, JSONExtractArrayRaw(argMax(strategies, event_time)) as strategies
+							from proposals_raw final
+							where dao_id = ?
+							group by proposal_id
+						),
+						votes as (
+							select proposal_id, voter, argMax(vp, created_at) as vp, argMax(vp_by_strategy, created_at) as vps
+							from votes_raw final
+							where dao_id = ? and (0 = ? or created_at >= date_sub(MONTH, ?, today()))
+							group by proposal_id, voter
+						),
+						voters as (
+							select v.voter as voter, avg(v.vp) as vp_avg,
+								   avg(arraySum(arrayMap((s, x) -> if(positionCaseInsensitive(JSONExtractString(s, 'name'), 'delegation') > 0, x, 0),
+									   arrayResize(p.strategies, length(v.vps)), v.vps))) as delegated_vp_avg
+							from votes v
+								left join proposals p on p.proposal_id = v.proposal_id
+							group by v.voter
+						)
+						select (select uniq(delegate) from active) as Delegates,
+							   (select uniq(delegator) from active) as Delegators,
+							   sum(delegated_vp_avg) as DelegatedVp,
+							   sum(vp_avg) as TotalVp
+						from voters
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, id, id, id, period, period).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetQuorumProposals returns finished not spam proposals of the dao with quorum and the time the quorum was reached by votes
+func (r *Repo) GetQuorumProposals(ctx context.Context, id uuid.UUID, period uint32) ([]*QuorumProposal, error) {
+	var res []*QuorumProposal
+	err := r.query(ctx).Raw(`with proposals as (
+							select proposal_id, argMax(start, event_time) as start_at, argMax("end", event_time) as end_at,
+								   argMax(quorum, event_time) as quorum, argMax(scores_total, event_time) as scores_total,
+								   argMax(votes, event_time) as votes, argMax(state, event_time) as state, argMax(spam, event_time) as spam,
+								   argMax(type, event_time) as type, argMax(scores, event_time) as scores
+							from proposals_raw final
+							where dao_id = ?
+							group by proposal_id
+							having spam = false and state in ('succeeded', 'failed', 'defeated') and quorum > 0
+								and (0 = ? or toDateTime(end_at) >= date_sub(MONTH, ?, today()))
+						),
+						voters as (
+							select proposal_id, voter, min(created_at) as first_vote, argMax(vp, created_at) as vp
+							from votes_raw final
+							where dao_id = ? and proposal_id in (select proposal_id from proposals)
+							group by proposal_id, voter
+						),
+						cumulative as (
+							select proposal_id, first_vote,
+								   sum(vp) over (partition by proposal_id order by first_vote, voter rows between unbounded preceding and current row) as cumulative_vp
+							from voters
+						),
+						reached as (
+							select c.proposal_id as proposal_id, min(c.first_vote) as reached_at
+							from cumulative c
+								inner join proposals p on p.proposal_id = c.proposal_id
+							where c.cumulative_vp >= p.quorum
+							group by c.proposal_id
+						)
+						select p.proposal_id as ProposalID, toDateTime(p.start_at) as Start, toDateTime(p.end_at) as End,
+							   p.quorum as Quorum, p.scores_total as ScoresTotal, p.votes as Votes, p.state as State,
+							   p.type as Type, p.scores as Scores, r.reached_at as QuorumReachedAt
+						from proposals p
+							left join reached r on r.proposal_id = p.proposal_id
+						order by End
+						SETTINGS join_use_nulls = 1, use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, period, period, id).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetTopAuthors(ctx context.Context, id uuid.UUID, period uint32, limit int, offset int) ([]*DaoAuthor, error) {
+	var res []*DaoAuthor
+	err := r.query(ctx).Raw(`select author as Author, `+authorProposalsMetrics+`
+						from (select proposal_id, argMax(ifNull(author, ''), created_at) as author, argMax(state, created_at) as state,
+									 argMax(spam, created_at) as spam, argMax(votes, created_at) as votes,
+									 argMax(scores_total, created_at) as scores_total, min(created_at) as created
+							  from proposals_raw final
+							  where dao_id = ? and (0 = ? or created_at >= date_sub(MONTH, ?, today()))
+							  group by proposal_id)
+						where author != ''
+						group by author
+						order by Proposals desc, Author
+						limit ? offset ?
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, period, period, limit, offset).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetAuthorDaos(ctx context.Context, author string) ([]*AuthorDao, error) {
+	var res []*AuthorDao
+	err := r.query(ctx).Raw(`select dao_id as DaoID, `+authorProposalsMetrics+`
+						from (select dao_id, proposal_id, argMax(state, created_at) as state, argMax(spam, created_at) as spam,
+									 argMax(votes, created_at) as votes, argMax(scores_total, created_at) as scores_total,
+									 min(created_at) as created
+							  from proposals_raw final
+							  where author = ?
+							  group by dao_id, proposal_id)
+						group by dao_id
+						order by LastProposal desc
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, author).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetMonthlyVotingApps returns votes and voters by the voting app per month, for all daos if id is uuid.Nil
+func (r *Repo) GetMonthlyVotingApps(ctx context.Context, id uuid.UUID, period uint32) ([]*AppVotes, error) {
+	var res []*AppVotes
+	err := r.query(ctx).Raw(`select toStartOfMonth(created_at) as PeriodStarted, if(app = '', 'unknown', app) as App,
+							uniq(dao_id, proposal_id, voter) as Votes, uniq(voter) as Voters
+						from votes_raw final
+							where (? = toUUID('00000000-0000-0000-0000-000000000000') or dao_id = ?)
+								and (0 = ? or created_at >= date_sub(MONTH, ?, toStartOfMonth(today())))
+						group by PeriodStarted, App
+						order by PeriodStarted, Votes desc
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`, id, id, period, period).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// GetMonthlyStrategyVp returns vp by the strategy name per month of the vote. Vp of the vote is split by strategies
+// of the proposal, vp_by_strategy follows the order of them. All proposals of the dao are used if proposalID is empty.
+func (r *Repo) GetMonthlyStrategyVp(ctx context.Context, id uuid.UUID, proposalID string, period uint32) ([]*StrategyVp, error) {
+	var res []*StrategyVp
+	err := r.query(ctx).Raw(`with proposals as (
+							select proposal_id, JSONExtractArrayRaw(argMax(strategies, event_time)) as strategies
+							from proposals_raw final
+							where dao_id = ? and (? = '' or proposal_id = ?)
+							group by proposal_id
+						),
+						votes as (
+							select proposal_id, voter, min(created_at) as first_vote, argMax(vp_by_strategy, created_at) as vps
+							from votes_raw final
+							where dao_id = ? and (? = '' or proposal_id = ?)
+								and (0 = ? or created_at >= date_sub(MONTH, ?, toStartOfMonth(today())))
+							group by proposal_id, voter
+						)
+						select toStartOfMonth(v.first_vote) as PeriodStarted,
+							   if(JSONExtractString(s.1, 'name') = '', 'unknown', JSONExtractString(s.1, 'name')) as Strategy,
+							   sum(s.2) as Vp
+						from votes v
+							inner join proposals p on p.proposal_id = v.proposal_id
+							array join arrayZip(arrayResize(p.strategies, length(v.vps)), v.vps) as s
+						group by PeriodStarted, Strategy
+						order by PeriodStarted, Vp desc
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 43200,
+							query_cache_store_results_of_queries_with_nondeterministic_functions = true`,
+		id, proposalID, proposalID, id, proposalID, proposalID, period, period).
 		Scan(&res).
 		Error
 
@@ -547,3 +1006,168 @@ func convertResultToMap(res []*TotalForDaos) map[uuid.UUID]float64 {
 
 	return m
 }
+
+// GetTopVotersByVpAfter returns voters of the dao ordered by average vp, votes and the last vote as of the time,
+// starting after the key
+func (r *Repo) GetTopVotersByVpAfter(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time, after *RankKey, limit int) ([]*RankedVoter, error) {
+	args := []any{id, asOf, period, period, asOf}
+	having := ""
+	if after != nil {
+		having = `having (VpAvg, VotesCount, LastVote) < (?, ?, ?) or ((VpAvg, VotesCount, LastVote) = (?, ?, ?) and Voter > ?)`
+		// float32 keys are passed as float64 to be compared exactly
+		args = append(args, float64(after.Value), after.Count, after.Time, float64(after.Value), after.Count, after.Time, after.ID)
+	}
+	args = append(args, limit)
+
+	var res []*RankedVoter
+	err := r.query(ctx).Raw(`select voter as Voter, toFloat32(avg(vp)) as VpAvg, uniq(proposal_id) as VotesCount, max(created_at) as LastVote
+						from votes_raw final
+						where dao_id = ? and created_at <= ? and (0 = ? or created_at >= date_sub(MONTH, ?, toDate(?)))
+						group by voter
+						`+having+`
+						order by VpAvg desc, VotesCount desc, LastVote desc, Voter
+						limit ?
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, args...).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetVotersCount(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time) (uint64, error) {
+	var res uint64
+	err := r.query(ctx).Raw(`select uniqExact(voter)
+						from votes_raw final
+						where dao_id = ? and created_at <= ? and (0 = ? or created_at >= date_sub(MONTH, ?, toDate(?)))
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`,
+		id, asOf, period, period, asOf).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// daoVotersAsOf selects voters of the dao who voted before the time
+const daoVotersAsOf = `select voter
+	from dao_voters_start_mv
+	where dao_id = ?
+	group by voter
+	having minMerge(start_date) <= ?`
+
+// GetMutualDaosAfter returns other daos ordered by voters of the dao who voted there as of the time,
+// starting after the key
+func (r *Repo) GetMutualDaosAfter(ctx context.Context, id uuid.UUID, asOf time.Time, after *RankKey, limit int) ([]*RankedMutualDao, error) {
+	args := []any{id, asOf, id, asOf}
+	having := ""
+	if after != nil {
+		having = `having VotersCount < ? or (VotersCount = ? and DaoID > ?)`
+		args = append(args, after.Count, after.Count, after.ID)
+	}
+	args = append(args, limit)
+
+	var res []*RankedMutualDao
+	err := r.query(ctx).Raw(`with voters as (`+daoVotersAsOf+`)
+						select dao_id as DaoID, toUInt32(count()) as VotersCount, (select count() from voters) as RequestedDaoVoters
+						from (select dao_id, voter
+							  from dao_voters_start_mv
+							  where voter in (select voter from voters) and dao_id != ?
+							  group by dao_id, voter
+							  having minMerge(start_date) <= ?)
+						group by dao_id
+						`+having+`
+						order by VotersCount desc, DaoID
+						limit ?
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, args...).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetMutualDaosCount(ctx context.Context, id uuid.UUID, asOf time.Time) (uint64, error) {
+	var res uint64
+	err := r.query(ctx).Raw(`select uniqExact(dao_id)
+						from (select dao_id, voter
+							  from dao_voters_start_mv
+							  where voter in (`+daoVotersAsOf+`) and dao_id != ?
+							  group by dao_id, voter
+							  having minMerge(start_date) <= ?)
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`,
+		id, asOf, id, asOf).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+// topDaosAsOf is the query of top daos with the time fixed by the as_of parameter to be able to read it by pages
+const topDaosAsOf = `with toDateTime(?) as as_of,
+	tokens as (
+		select dao_id, max(created_at) as period_end, argMax(price, created_at) as current_price,
+			   min(created_day) as period_start, argMin(price, created_at) as period_start_price
+		from token_price
+		where created_at <= as_of and created_at >= multiIf(?='1W', date_sub(WEEK, 1, as_of), ?='1M', date_sub(MONTH, 1, as_of), date_sub(HOUR, 24, as_of))
+			and dao_id in (select dao_id from (select w.dao_id, argMax(w.disabled, w.created_at) as disabled from whitelist w where w.feature_type='TOP' group by w.dao_id) s where s.disabled = false)
+			and multiIf('new'=?, dao_id in (select distinct dao_id from daos_raw where event_type='dao_created' and created_day >= date_sub(MONTH, 3, toDate(as_of)) and created_at <= as_of),
+						 dao_id not in (select distinct dao_id from daos_raw where event_type='dao_created' and created_day >= date_sub(MONTH, 3, toDate(as_of)) and created_at <= as_of))
+		group by dao_id
+	),
+	proposals as (
+		select p.dao_id, proposal_id, argMax(scores_total, event_time) as vp, argMax(votes, event_time) as voters,
+			   argMax(spam, event_time) as spam, argMax(state, event_time) as state
+		from proposals_raw p final
+		where p.dao_id in (select distinct t.dao_id from tokens t where period_end >= date_sub(DAY, 1, as_of))
+			and created_at <= as_of
+			and toDateTime("end") <= toDate(as_of) and toDateTime("end") >= multiIf(?=0, date_sub(WEEK, 1, toDate(as_of)), date_sub(MONTH, ?, toDate(as_of)))
+		group by p.dao_id, proposal_id
+	)
+	select p.dao_id as DaoID, sum(p.voters) as Voters, uniq(p.proposal_id) as Proposals,
+		   sum(p.vp)/Proposals as AvpToken, toFloat32(max(t.current_price) * AvpToken) as AvpUsd, max(t.current_price) as TokenPrice,
+		   multiIf(max(t.period_start_price) = 0, 0, (TokenPrice - max(t.period_start_price)) / max(t.period_start_price)) as TokenPriceChange
+	from proposals p
+		inner join tokens t on t.dao_id = p.dao_id
+	where p.spam != true and p.state != 'canceled'
+	group by p.dao_id`
+
+func topDaosAsOfArgs(category string, interval string, pricePeriod string, asOf time.Time) []any {
+	i, ok := Intervals[interval]
+	if !ok {
+		i = 1
+	}
+
+	return []any{asOf, pricePeriod, pricePeriod, category, i, i}
+}
+
+// GetTopDaosAfter returns top daos ordered by average vp in usd as of the time, starting after the key.
+// Index isn't set.
+func (r *Repo) GetTopDaosAfter(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time, after *RankKey, limit int) ([]*TopDao, error) {
+	args := topDaosAsOfArgs(category, interval, pricePeriod, asOf)
+	where := ""
+	if after != nil {
+		where = `where AvpUsd < ? or (AvpUsd = ? and DaoID > ?)`
+		args = append(args, float64(after.Value), float64(after.Value), after.ID)
+	}
+	args = append(args, limit)
+
+	var res []*TopDao
+	err := r.query(ctx).Raw(`select * from (`+topDaosAsOf+`)
+						`+where+`
+						order by AvpUsd desc, DaoID
+						limit ?
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`, args...).
+		Scan(&res).
+		Error
+
+	return res, err
+}
+
+func (r *Repo) GetTopDaosCount(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time) (uint64, error) {
+	var res uint64
+	err := r.query(ctx).Raw(`select count() from (`+topDaosAsOf+`)
+						SETTINGS use_query_cache = true, query_cache_min_query_duration = 3000, query_cache_ttl = 3600`,
+		topDaosAsOfArgs(category, interval, pricePeriod, asOf)...).
+		Scan(&res).
+		Error
+
+	return res, err
+}
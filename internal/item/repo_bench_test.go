@@ -0,0 +1,107 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// benchDSNEnv is the dsn of the clickhouse the raw reads are benchmarked against,
+// e.g. clickhouse://default:@127.0.0.1:9000/default
+const benchDSNEnv = "CLICKHOUSE_BENCH_DSN"
+
+const (
+	benchTable  = "votes_raw_read_bench"
+	benchMonths = 24
+	benchRows   = 2_000_000
+)
+
+// BenchmarkRawReads compares the top voters query on the deduplicated votes table read without FINAL,
+// with FINAL and with FINAL not merging across partitions. Half of the months are merged before the run.
+func BenchmarkRawReads(b *testing.B) {
+	dsn := os.Getenv(benchDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", benchDSNEnv)
+	}
+
+	opts, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		b.Fatalf("parse dsn: %v", err)
+	}
+	conn := clickhouse.OpenDB(opts)
+	b.Cleanup(func() { _ = conn.Close() })
+
+	ctx := context.Background()
+	prepareRawReadsTable(ctx, b, conn)
+
+	query := fmt.Sprintf(`select voter, avg(vp) as vp_avg, uniq(proposal_id) as votes
+		from %s %%s
+		where dao_id = '5f4d1b1c-7a52-4c8f-9c6e-0a1b2c3d4e5f'
+		group by voter
+		order by vp_avg desc
+		limit 100`, benchTable)
+
+	for name, tc := range map[string]struct {
+		final    string
+		settings clickhouse.Settings
+	}{
+		"no_final":                 {},
+		"final":                    {final: "final"},
+		"final_without_cross_part": {final: "final", settings: clickhouse.Settings{"do_not_merge_across_partitions_select_final": 1}},
+	} {
+		b.Run(name, func(b *testing.B) {
+			qctx := clickhouse.Context(ctx, clickhouse.WithSettings(tc.settings))
+			for i := 0; i < b.N; i++ {
+				rows, err := conn.QueryContext(qctx, fmt.Sprintf(query, tc.final))
+				if err != nil {
+					b.Fatalf("query: %v", err)
+				}
+				for rows.Next() {
+				}
+				if err = rows.Close(); err != nil {
+					b.Fatalf("read: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// prepareRawReadsTable fills the table partitioned like votes_raw with 1% of redelivered rows
+func prepareRawReadsTable(ctx context.Context, b *testing.B, conn *sql.DB) {
+	b.Helper()
+
+	queries := []string{
+		fmt.Sprintf("drop table if exists %s", benchTable),
+		fmt.Sprintf(`create table %s (
+			dao_id UUID,
+			created_day Date default toDate(created_at),
+			created_at DateTime,
+			proposal_id String,
+			voter String,
+			vp Float64,
+			event_id String
+		) engine = ReplacingMergeTree partition by toYYYYMM(created_day) order by (dao_id, proposal_id, created_day, event_id)`, benchTable),
+		fmt.Sprintf(`insert into %s (dao_id, created_at, proposal_id, voter, vp, event_id)
+			select '5f4d1b1c-7a52-4c8f-9c6e-0a1b2c3d4e5f', addMonths(toDateTime('2022-01-01 00:00:00'), number %% %d) + number %% 86400,
+				   concat('proposal-', toString(number %% 1000)), concat('0x', toString(number %% 50000)), number %% 1000, toString(number)
+			from numbers(%d)`, benchTable, benchMonths, benchRows),
+		fmt.Sprintf(`insert into %s (dao_id, created_at, proposal_id, voter, vp, event_id)
+			select dao_id, created_at, proposal_id, voter, vp, event_id from %s where cityHash64(event_id) %% 100 = 0`, benchTable, benchTable),
+	}
+	for month := 0; month < benchMonths/2; month++ {
+		queries = append(queries, fmt.Sprintf("optimize table %s partition %d final", benchTable, (2022+month/12)*100+month%12+1))
+	}
+
+	for _, query := range queries {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			b.Fatalf("prepare table: %v", err)
+		}
+	}
+	b.Cleanup(func() {
+		_, _ = conn.ExecContext(ctx, fmt.Sprintf("drop table if exists %s", benchTable))
+	})
+}
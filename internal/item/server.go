@@ -2,16 +2,11 @@ package item
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
 
-	"github.com/google/uuid"
 	"github.com/goverland-labs/goverland-analytics-api-protocol/protobuf/internalapi"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
-	"gorm.io/gorm"
 )
 
 type Server struct {
@@ -26,15 +21,15 @@ func NewServer(service *Service) *Server {
 	}
 }
 
-func (s *Server) GetMonthlyActiveUsers(_ context.Context, req *internalapi.MonthlyActiveUsersRequest) (*internalapi.MonthlyActiveUsersResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetMonthlyActiveUsers(ctx context.Context, req *internalapi.MonthlyActiveUsersRequest) (*internalapi.MonthlyActiveUsersResponse, error) {
+	id, err := validateDaoPeriodRequest(req.GetDaoId(), req.GetPeriodInMonths())
 	if err != nil {
 		return nil, err
 	}
 
-	users, err := s.service.GetMonthlyActiveUsers(id, req.GetPeriodInMonths())
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no users for this dao ID")
+	users, err := s.service.GetMonthlyActiveUsers(ctx, id, req.GetPeriodInMonths())
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.MonthlyActiveUsersResponse{
@@ -42,15 +37,15 @@ func (s *Server) GetMonthlyActiveUsers(_ context.Context, req *internalapi.Month
 	}, nil
 }
 
-func (s *Server) GetVoterBuckets(_ context.Context, req *internalapi.VoterBucketsRequest) (*internalapi.VoterBucketsResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetVoterBuckets(ctx context.Context, req *internalapi.VoterBucketsRequest) (*internalapi.VoterBucketsResponse, error) {
+	id, err := validateDaoRequest(req.GetDaoId())
 	if err != nil {
 		return nil, err
 	}
 
-	buckets, err := s.service.GetVoterBuckets(id)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no votes for this dao ID")
+	buckets, err := s.service.GetVoterBuckets(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.VoterBucketsResponse{
@@ -58,22 +53,19 @@ func (s *Server) GetVoterBuckets(_ context.Context, req *internalapi.VoterBucket
 	}, nil
 }
 
-func (s *Server) GetVoterBucketsV2(_ context.Context, req *internalapi.VoterBucketsRequestV2) (*internalapi.VoterBucketsResponse, error) {
-	groups := req.Groups
-	gcount := len(groups)
-	if gcount == 0 {
-		return nil, nil
-	}
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetVoterBucketsV2(ctx context.Context, req *internalapi.VoterBucketsRequestV2) (*internalapi.VoterBucketsResponse, error) {
+	id, err := validateVoterBucketsV2Request(req)
 	if err != nil {
 		return nil, err
 	}
 
-	buckets, err := s.service.GetVotesGroups(id)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no votes for this dao ID")
+	buckets, err := s.service.GetVotesGroups(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
+	groups := req.Groups
+	gcount := len(groups)
 	res := make([]*internalapi.VoterGroup, len(groups))
 	var count uint64 = 0
 	groupId := 0
@@ -117,15 +109,18 @@ func (s *Server) GetVoterBucketsV2(_ context.Context, req *internalapi.VoterBuck
 	}, nil
 }
 
-func (s *Server) GetExclusiveVoters(_ context.Context, req *internalapi.ExclusiveVotersRequest) (*internalapi.ExclusiveVotersResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetExclusiveVoters(ctx context.Context, req *internalapi.ExclusiveVotersRequest) (*internalapi.ExclusiveVotersResponse, error) {
+	id, err := validateDaoRequest(req.GetDaoId())
 	if err != nil {
 		return nil, err
 	}
 
-	ev, err := s.service.GetExclusiveVoters(id)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no votes for this dao ID")
+	ev, err := s.service.GetExclusiveVoters(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ev == nil {
+		return &internalapi.ExclusiveVotersResponse{}, nil
 	}
 
 	return &internalapi.ExclusiveVotersResponse{
@@ -134,14 +129,15 @@ func (s *Server) GetExclusiveVoters(_ context.Context, req *internalapi.Exclusiv
 	}, nil
 }
 
-func (s *Server) GetMonthlyNewProposals(_ context.Context, req *internalapi.MonthlyNewProposalsRequest) (*internalapi.MonthlyNewProposalsResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetMonthlyNewProposals(ctx context.Context, req *internalapi.MonthlyNewProposalsRequest) (*internalapi.MonthlyNewProposalsResponse, error) {
+	id, err := validateDaoPeriodRequest(req.GetDaoId(), req.GetPeriodInMonths())
 	if err != nil {
 		return nil, err
 	}
-	proposals, err := s.service.GetMonthlyNewProposals(id, req.GetPeriodInMonths())
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no proposals for this dao ID")
+
+	proposals, err := s.service.GetMonthlyNewProposals(ctx, id, req.GetPeriodInMonths())
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.MonthlyNewProposalsResponse{
@@ -149,15 +145,18 @@ func (s *Server) GetMonthlyNewProposals(_ context.Context, req *internalapi.Mont
 	}, nil
 }
 
-func (s *Server) GetSucceededProposalsCount(_ context.Context, req *internalapi.SucceededProposalsCountRequest) (*internalapi.SucceededProposalsCountResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetSucceededProposalsCount(ctx context.Context, req *internalapi.SucceededProposalsCountRequest) (*internalapi.SucceededProposalsCountResponse, error) {
+	id, err := validateDaoRequest(req.GetDaoId())
 	if err != nil {
 		return nil, err
 	}
 
-	spc, err := s.service.GetSucceededProposalsCount(id)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no finished proposals for this dao ID")
+	spc, err := s.service.GetSucceededProposalsCount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if spc == nil {
+		return &internalapi.SucceededProposalsCountResponse{}, nil
 	}
 
 	return &internalapi.SucceededProposalsCountResponse{
@@ -166,15 +165,23 @@ func (s *Server) GetSucceededProposalsCount(_ context.Context, req *internalapi.
 	}, nil
 }
 
-func (s *Server) GetTopVotersByVp(_ context.Context, req *internalapi.TopVotersByVpRequest) (*internalapi.TopVotersByVpResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetTopVotersByVp(ctx context.Context, req *internalapi.TopVotersByVpRequest) (*internalapi.TopVotersByVpResponse, error) {
+	id, err := validateTopVotersByVpRequest(req)
 	if err != nil {
 		return nil, err
 	}
-	totals, _ := s.service.GetTotalVpAvg(id, req.GetPeriodInMonths())
-	voters, err := s.service.GetTopVotersByVp(id, req.GetOffset(), req.GetLimit(), req.GetPeriodInMonths())
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no users for this dao ID")
+
+	totals, err := s.service.GetTotalVpAvg(ctx, id, req.GetPeriodInMonths())
+	if err != nil {
+		return nil, err
+	}
+	if totals == nil {
+		totals = &VpAvgTotal{}
+	}
+
+	voters, err := s.service.GetTopVotersByVp(ctx, id, req.GetOffset(), listLimit(req.GetLimit()), req.GetPeriodInMonths())
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.TopVotersByVpResponse{
@@ -184,57 +191,52 @@ func (s *Server) GetTopVotersByVp(_ context.Context, req *internalapi.TopVotersB
 	}, nil
 }
 
-func (s *Server) GetDaosVotersParticipateIn(_ context.Context, req *internalapi.DaosVotersParticipateInRequest) (*internalapi.DaosVotersParticipateInResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetDaosVotersParticipateIn(ctx context.Context, req *internalapi.DaosVotersParticipateInRequest) (*internalapi.DaosVotersParticipateInResponse, error) {
+	id, err := validateDaosVotersParticipateInRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
-	daos, err := s.service.GetMutualDaos(id, req.GetLimit())
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no daos")
+	// the limit is validated to fit uint32
+	page, err := s.service.GetMutualDaosPage(ctx, id, "", uint32(req.GetLimit()))
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.DaosVotersParticipateInResponse{
-		DaoVotersParticipateIn: convertMutualDaoToAPI(daos),
+		DaoVotersParticipateIn: convertMutualDaoToAPI(page.Items),
 	}, nil
 }
 
-func (s *Server) GetTotalsForLastPeriods(_ context.Context, req *internalapi.TotalsForLastPeriodsRequest) (*internalapi.TotalsForLastPeriodsResponse, error) {
-	totals, err := s.service.GetTotalsForLastPeriods(req.GetPeriodInDays())
+func (s *Server) GetTotalsForLastPeriods(ctx context.Context, req *internalapi.TotalsForLastPeriodsRequest) (*internalapi.TotalsForLastPeriodsResponse, error) {
+	if err := validateTotalsForLastPeriodsRequest(req); err != nil {
+		return nil, err
+	}
 
-	return &internalapi.TotalsForLastPeriodsResponse{
-		Daos: &internalapi.Totals{
-			CurrentPeriodTotal:  totals.Daos.Current,
-			PreviousPeriodTotal: totals.Daos.Previous,
-		},
-		Proposals: &internalapi.Totals{
-			CurrentPeriodTotal:  totals.Proposals.Current,
-			PreviousPeriodTotal: totals.Proposals.Previous,
-		},
-		Voters: &internalapi.Totals{
-			CurrentPeriodTotal:  totals.Voters.Current,
-			PreviousPeriodTotal: totals.Voters.Previous,
-		},
-		Votes: &internalapi.Totals{
-			CurrentPeriodTotal:  totals.Votes.Current,
-			PreviousPeriodTotal: totals.Votes.Previous,
-		},
-	}, err
+	totals, err := s.service.GetTotalsForLastPeriods(ctx, periodInDays(req.GetPeriodInDays()))
+	if err != nil {
+		return nil, err
+	}
+
+	return convertEcosystemTotalsToAPI(totals), nil
 }
 
-func (s *Server) GetMonthlyActive(_ context.Context, req *internalapi.MonthlyActiveRequest) (*internalapi.MonthlyActiveResponse, error) {
+func (s *Server) GetMonthlyActive(ctx context.Context, req *internalapi.MonthlyActiveRequest) (*internalapi.MonthlyActiveResponse, error) {
+	if err := validateMonthlyActiveRequest(req); err != nil {
+		return nil, err
+	}
+
 	var (
 		mt  []*MonthlyTotal
 		err error
 	)
 	switch req.Type {
 	case internalapi.ObjectType_OBJECT_TYPE_DAO:
-		mt, err = s.service.GetMonthlyDaos()
+		mt, err = s.service.GetMonthlyDaos(ctx)
 	case internalapi.ObjectType_OBJECT_TYPE_PROPOSAL:
-		mt, err = s.service.GetMonthlyProposals()
+		mt, err = s.service.GetMonthlyProposals(ctx)
 	case internalapi.ObjectType_OBJECT_TYPE_VOTER:
-		mt, err = s.service.GetMonthlyVoters()
+		mt, err = s.service.GetMonthlyVoters(ctx)
 	}
 	if err != nil {
 		return nil, err
@@ -245,14 +247,18 @@ func (s *Server) GetMonthlyActive(_ context.Context, req *internalapi.MonthlyAct
 	}, nil
 }
 
-func (s *Server) GetAvgVpList(_ context.Context, req *internalapi.GetAvgVpListRequest) (*internalapi.GetAvgVpListResponse, error) {
-	id, err := getDaoUuid(req.GetDaoId())
+func (s *Server) GetAvgVpList(ctx context.Context, req *internalapi.GetAvgVpListRequest) (*internalapi.GetAvgVpListResponse, error) {
+	id, err := validateAvgVpListRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	vph, err := s.service.GetVpAvgList(ctx, id, req.GetPeriodInMonths(), req.GetMinBalance())
 	if err != nil {
 		return nil, err
 	}
-	vph, err := s.service.GetVpAvgList(id, req.GetPeriodInMonths(), req.GetMinBalance())
-	if err != nil || vph == nil {
-		return &internalapi.GetAvgVpListResponse{}, err
+	if vph == nil {
+		return &internalapi.GetAvgVpListResponse{}, nil
 	}
 
 	return &internalapi.GetAvgVpListResponse{
@@ -265,27 +271,40 @@ func (s *Server) GetAvgVpList(_ context.Context, req *internalapi.GetAvgVpListRe
 	}, nil
 }
 
-func (s *Server) GetTopDaos(_ context.Context, req *internalapi.GetTopDaosRequest) (*internalapi.GetTopDaosResponse, error) {
-	td, err := s.service.GetTopDaos(req.GetCategory(), req.GetInterval(), req.GetPrice())
-	if err != nil || td == nil {
-		return &internalapi.GetTopDaosResponse{}, err
+func (s *Server) GetTopDaos(ctx context.Context, req *internalapi.GetTopDaosRequest) (*internalapi.GetTopDaosResponse, error) {
+	if err := validateTopDaosRequest(req); err != nil {
+		return nil, err
+	}
+
+	page, err := s.service.GetTopDaosPage(ctx, req.GetCategory(), req.GetInterval(), req.GetPrice(), "", 0)
+	if err != nil {
+		return nil, err
 	}
 
 	return &internalapi.GetTopDaosResponse{
-		TopDao: convertTopDaosToAPI(td),
+		TopDao: convertTopDaosToAPI(page.Items),
 	}, nil
 }
 
-func getDaoUuid(daoId string) (uuid.UUID, error) {
-	if daoId == "" {
-		return uuid.UUID{}, status.Error(codes.InvalidArgument, "invalid dao ID")
-	}
-
-	id, err := uuid.Parse(daoId)
-	if err != nil {
-		return uuid.UUID{}, status.Error(codes.InvalidArgument, "invalid dao ID format")
+func convertEcosystemTotalsToAPI(totals *EcosystemTotals) *internalapi.TotalsForLastPeriodsResponse {
+	return &internalapi.TotalsForLastPeriodsResponse{
+		Daos: &internalapi.Totals{
+			CurrentPeriodTotal:  totals.Daos.Current,
+			PreviousPeriodTotal: totals.Daos.Previous,
+		},
+		Proposals: &internalapi.Totals{
+			CurrentPeriodTotal:  totals.Proposals.Current,
+			PreviousPeriodTotal: totals.Proposals.Previous,
+		},
+		Voters: &internalapi.Totals{
+			CurrentPeriodTotal:  totals.Voters.Current,
+			PreviousPeriodTotal: totals.Voters.Previous,
+		},
+		Votes: &internalapi.Totals{
+			CurrentPeriodTotal:  totals.Votes.Current,
+			PreviousPeriodTotal: totals.Votes.Previous,
+		},
 	}
-	return id, nil
 }
 
 func convertMonthlyActiveUsersToAPI(users []*MonthlyActiveUser) []*internalapi.MonthlyActiveUsers {
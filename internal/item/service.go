@@ -1,47 +1,77 @@
 package item
 
 import (
+	"cmp"
 	"context"
-	"errors"
+	"fmt"
 	pevents "github.com/goverland-labs/goverland-platform-events/events/core"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 	"math"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-const popularDaoIndexCalculationPeriod = 90
+const (
+	popularDaoIndexCalculationPeriod = 90
+	proposalFinalPeriod              = 24 * time.Hour
+	// pageSnapshotPrecision truncates the snapshot time of ranked lists, so first pages requested within
+	// the same minute share cached results
+	pageSnapshotPrecision = time.Minute
+)
 
 type Publisher interface {
 	PublishJSON(ctx context.Context, subject string, obj any) error
 }
 
 type DataProvider interface {
-	GetMonthlyActiveUsersByDaoId(id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error)
-	GetVoterBucketsByDaoId(id uuid.UUID) ([]*Bucket, error)
-	GetVotesGroupsByDaoId(id uuid.UUID) ([]*Bucket, error)
-	GetExclusiveVotersByDaoId(id uuid.UUID) (*ExclusiveVoters, error)
-	GetMonthlyNewProposalsByDaoId(id uuid.UUID, period uint32) ([]*ProposalsByMonth, error)
-	GetProposalsCountByDaoId(id uuid.UUID) (*FinalProposalCounts, error)
-	GetMutualDaos(id uuid.UUID, limit uint64) ([]*DaoVoters, error)
-	GetTopVotersByVp(id uuid.UUID, limit int, offset int, period uint32) ([]*VoterWithVp, error)
-	GetTotalVpAvgForActiveVoters(id uuid.UUID, period uint32) (*VpAvgTotal, error)
-	GetVoterTotalsForPeriods(periodInDays uint32) (*VoterTotals, error)
-	GetDaoProposalTotalsForPeriods(periodInDays uint32) (*ActiveDaoProposalTotals, error)
-	GetMonthlyDaos() ([]*MonthlyTotal, error)
-	GetMonthlyProposals() ([]*MonthlyTotal, error)
-	GetMonthlyVoters() ([]*MonthlyTotal, error)
-	GetDaoProposalForPeriod(period uint8) (map[uuid.UUID]float64, error)
-	GetDaoVotersForPeriod(period uint8) (map[uuid.UUID]float64, error)
-	GetDaoVotesForPeriod(period uint8) (map[uuid.UUID]float64, error)
-	GetGoverlandIndexAdditives() (map[uuid.UUID]float64, error)
-	GetDaos() ([]uuid.UUID, error)
-	GetVpAvgList(id uuid.UUID, period uint32, price float32) ([]float32, error)
-	GetTokenPrice(id uuid.UUID) (float32, error)
-	GetTopDaos(category string, interval string, pricePeriod string) ([]*TopDao, error)
+	GetMonthlyActiveUsersByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error)
+	GetVoterBucketsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error)
+	GetVotesGroupsByDaoId(ctx context.Context, id uuid.UUID) ([]*Bucket, error)
+	GetExclusiveVotersByDaoId(ctx context.Context, id uuid.UUID) (*ExclusiveVoters, error)
+	GetMonthlyNewProposalsByDaoId(ctx context.Context, id uuid.UUID, period uint32) ([]*ProposalsByMonth, error)
+	GetProposalsCountByDaoId(ctx context.Context, id uuid.UUID) (*FinalProposalCounts, error)
+	GetTopVotersByVp(ctx context.Context, id uuid.UUID, limit int, offset int, period uint32) ([]*VoterWithVp, error)
+	GetTotalVpAvgForActiveVoters(ctx context.Context, id uuid.UUID, period uint32) (*VpAvgTotal, error)
+	GetVoterTotalsForPeriods(ctx context.Context, periodInDays uint32) (*VoterTotals, error)
+	GetDaoProposalTotalsForPeriods(ctx context.Context, periodInDays uint32) (*ActiveDaoProposalTotals, error)
+	GetCurrentVoterTotalsForPeriods(ctx context.Context, periodInDays uint32) (*VoterTotals, error)
+	GetCurrentDaoProposalTotalsForPeriods(ctx context.Context, periodInDays uint32) (*ActiveDaoProposalTotals, error)
+	GetMonthlyDaos(ctx context.Context) ([]*MonthlyTotal, error)
+	GetMonthlyProposals(ctx context.Context) ([]*MonthlyTotal, error)
+	GetMonthlyVoters(ctx context.Context) ([]*MonthlyTotal, error)
+	GetDaoProposalForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error)
+	GetDaoVotersForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error)
+	GetDaoVotesForPeriod(ctx context.Context, period uint8) (map[uuid.UUID]float64, error)
+	GetGoverlandIndexAdditives(ctx context.Context) (map[uuid.UUID]float64, error)
+	GetDaos(ctx context.Context) ([]uuid.UUID, error)
+	GetVpAvgList(ctx context.Context, id uuid.UUID, period uint32, price float32) ([]float32, error)
+	GetTokenPrice(ctx context.Context, id uuid.UUID) (float32, error)
+	GetProposalInfo(ctx context.Context, proposalID string) (*ProposalInfo, error)
+	GetProposalVotesTimeline(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalVotesBucket, error)
+	GetProposalChoices(ctx context.Context, daoID uuid.UUID, proposalID string) ([]*ProposalChoice, error)
+	GetProposalVpTotals(ctx context.Context, daoID uuid.UUID, proposalID string, finalPeriodFrom time.Time, quorum float64) (*ProposalVpTotals, error)
+	GetVoterDaos(ctx context.Context, voter string) ([]*VoterDao, error)
+	GetVoterMonthlyActivity(ctx context.Context, voter string) ([]*VoterMonthlyActivity, error)
+	GetVoterRetention(ctx context.Context, id uuid.UUID, months uint32) ([]*RetentionCell, error)
+	GetVpConcentration(ctx context.Context, id uuid.UUID, period uint32) (*VpConcentration, error)
+	GetMonthlyVpConcentration(ctx context.Context, id uuid.UUID, period uint32) ([]*VpConcentration, error)
+	GetProposalOutcomes(ctx context.Context, id uuid.UUID) ([]*ProposalOutcome, error)
+	GetTopDelegates(ctx context.Context, id uuid.UUID, limit int, offset int) ([]*Delegate, error)
+	GetDelegatedVp(ctx context.Context, id uuid.UUID, period uint32) (*DelegatedVp, error)
+	GetQuorumProposals(ctx context.Context, id uuid.UUID, period uint32) ([]*QuorumProposal, error)
+	GetTopAuthors(ctx context.Context, id uuid.UUID, period uint32, limit int, offset int) ([]*DaoAuthor, error)
+	GetAuthorDaos(ctx context.Context, author string) ([]*AuthorDao, error)
+	GetMonthlyVotingApps(ctx context.Context, id uuid.UUID, period uint32) ([]*AppVotes, error)
+	GetMonthlyStrategyVp(ctx context.Context, id uuid.UUID, proposalID string, period uint32) ([]*StrategyVp, error)
+	GetTopVotersByVpAfter(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time, after *RankKey, limit int) ([]*RankedVoter, error)
+	GetVotersCount(ctx context.Context, id uuid.UUID, period uint32, asOf time.Time) (uint64, error)
+	GetMutualDaosAfter(ctx context.Context, id uuid.UUID, asOf time.Time, after *RankKey, limit int) ([]*RankedMutualDao, error)
+	GetMutualDaosCount(ctx context.Context, id uuid.UUID, asOf time.Time) (uint64, error)
+	GetTopDaosAfter(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time, after *RankKey, limit int) ([]*TopDao, error)
+	GetTopDaosCount(ctx context.Context, category string, interval string, pricePeriod string, asOf time.Time) (uint64, error)
 }
 
 type Service struct {
@@ -56,64 +86,48 @@ func NewService(p Publisher, r DataProvider) (*Service, error) {
 	}, nil
 }
 
-func (s *Service) GetMonthlyActiveUsers(id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error) {
-	return s.repo.GetMonthlyActiveUsersByDaoId(id, period)
-}
-
-func (s *Service) GetVoterBuckets(id uuid.UUID) ([]*Bucket, error) {
-	return s.repo.GetVoterBucketsByDaoId(id)
+func (s *Service) GetMonthlyActiveUsers(ctx context.Context, id uuid.UUID, period uint32) ([]*MonthlyActiveUser, error) {
+	return s.repo.GetMonthlyActiveUsersByDaoId(ctx, id, period)
 }
 
-func (s *Service) GetVotesGroups(id uuid.UUID) ([]*Bucket, error) {
-	return s.repo.GetVotesGroupsByDaoId(id)
+func (s *Service) GetVoterBuckets(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
+	return s.repo.GetVoterBucketsByDaoId(ctx, id)
 }
 
-func (s *Service) GetExclusiveVoters(id uuid.UUID) (*ExclusiveVoters, error) {
-	return s.repo.GetExclusiveVotersByDaoId(id)
+func (s *Service) GetVotesGroups(ctx context.Context, id uuid.UUID) ([]*Bucket, error) {
+	return s.repo.GetVotesGroupsByDaoId(ctx, id)
 }
 
-func (s *Service) GetMonthlyNewProposals(id uuid.UUID, period uint32) ([]*ProposalsByMonth, error) {
-	return s.repo.GetMonthlyNewProposalsByDaoId(id, period)
+func (s *Service) GetExclusiveVoters(ctx context.Context, id uuid.UUID) (*ExclusiveVoters, error) {
+	return s.repo.GetExclusiveVotersByDaoId(ctx, id)
 }
 
-func (s *Service) GetSucceededProposalsCount(id uuid.UUID) (*FinalProposalCounts, error) {
-	return s.repo.GetProposalsCountByDaoId(id)
+func (s *Service) GetMonthlyNewProposals(ctx context.Context, id uuid.UUID, period uint32) ([]*ProposalsByMonth, error) {
+	return s.repo.GetMonthlyNewProposalsByDaoId(ctx, id, period)
 }
 
-func (s *Service) GetMutualDaos(id uuid.UUID, limit uint64) ([]*MutualDao, error) {
-	daos, err := s.repo.GetMutualDaos(id, limit+1)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, status.Error(codes.InvalidArgument, "no daos")
-	}
-	if len(daos) == 0 {
-		return nil, err
-	}
-	dcount := daos[0].VotersCount
-	res := make([]*MutualDao, len(daos)-1)
-	for i, dao := range daos[1:] {
-		res[i] = &MutualDao{
-			DaoID:         dao.DaoID,
-			VotersCount:   dao.VotersCount,
-			VotersPercent: float32(dao.VotersCount) / float32(dcount) * 100.0,
-		}
-	}
-	return res, nil
+func (s *Service) GetSucceededProposalsCount(ctx context.Context, id uuid.UUID) (*FinalProposalCounts, error) {
+	return s.repo.GetProposalsCountByDaoId(ctx, id)
 }
 
-func (s *Service) GetTopVotersByVp(id uuid.UUID, offset uint32, limit uint32, period uint32) ([]*VoterWithVp, error) {
-	return s.repo.GetTopVotersByVp(id, int(offset), int(limit), period)
+func (s *Service) GetTopVotersByVp(ctx context.Context, id uuid.UUID, offset uint32, limit uint32, period uint32) ([]*VoterWithVp, error) {
+	return s.repo.GetTopVotersByVp(ctx, id, int(offset), int(limit), period)
 }
 
-func (s *Service) GetTotalVpAvg(id uuid.UUID, period uint32) (*VpAvgTotal, error) {
-	return s.repo.GetTotalVpAvgForActiveVoters(id, period)
+func (s *Service) GetTotalVpAvg(ctx context.Context, id uuid.UUID, period uint32) (*VpAvgTotal, error) {
+	return s.repo.GetTotalVpAvgForActiveVoters(ctx, id, period)
 }
 
-func (s *Service) GetVpAvgList(id uuid.UUID, period uint32, minBalance float32) (*VpHistogram, error) {
-	price, err := s.repo.GetTokenPrice(id)
+func (s *Service) GetVpAvgList(ctx context.Context, id uuid.UUID, period uint32, minBalance float32) (*VpHistogram, error) {
+	price, err := s.repo.GetTokenPrice(ctx, id)
 	if err != nil || price <= 0 {
 		return nil, err
 	}
-	list, _ := s.repo.GetVpAvgList(id, period, price)
+	list, err := s.repo.GetVpAvgList(ctx, id, period, price)
+	if err != nil {
+		return nil, err
+	}
+
 	var avpTotal float32 = 0
 	voterCutted := 0
 	for _, vp := range list {
@@ -175,9 +189,44 @@ func (s *Service) GetVpAvgList(id uuid.UUID, period uint32, minBalance float32)
 	}, nil
 }
 
-func (s *Service) GetTotalsForLastPeriods(period uint32) (*EcosystemTotals, error) {
-	dp, _ := s.repo.GetDaoProposalTotalsForPeriods(period)
-	vv, _ := s.repo.GetVoterTotalsForPeriods(period)
+func (s *Service) GetTotalsForLastPeriods(ctx context.Context, period uint32) (*EcosystemTotals, error) {
+	dp, err := s.repo.GetDaoProposalTotalsForPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	vv, err := s.repo.GetVoterTotalsForPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	if dp == nil || vv == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return newEcosystemTotals(dp, vv), nil
+}
+
+// GetCurrentTotalsForLastPeriods calculates totals bypassing the query cache
+func (s *Service) GetCurrentTotalsForLastPeriods(ctx context.Context, period uint32) (*EcosystemTotals, error) {
+	dp, err := s.repo.GetCurrentDaoProposalTotalsForPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	vv, err := s.repo.GetCurrentVoterTotalsForPeriods(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	if dp == nil || vv == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return newEcosystemTotals(dp, vv), nil
+}
+
+func newEcosystemTotals(dp *ActiveDaoProposalTotals, vv *VoterTotals) *EcosystemTotals {
 	return &EcosystemTotals{
 		Daos: TotalsForTwoPeriods{
 			Current:  dp.DaoTotal,
@@ -195,57 +244,676 @@ func (s *Service) GetTotalsForLastPeriods(period uint32) (*EcosystemTotals, erro
 			Current:  vv.VotesTotal,
 			Previous: vv.VotesTotalPrevPeriod,
 		},
+	}
+}
+
+func (s *Service) GetMonthlyDaos(ctx context.Context) ([]*MonthlyTotal, error) {
+	return s.repo.GetMonthlyDaos(ctx)
+}
+
+func (s *Service) GetMonthlyProposals(ctx context.Context) ([]*MonthlyTotal, error) {
+	return s.repo.GetMonthlyProposals(ctx)
+}
+
+func (s *Service) GetMonthlyVoters(ctx context.Context) ([]*MonthlyTotal, error) {
+	return s.repo.GetMonthlyVoters(ctx)
+}
+
+func (s *Service) GetProposalAnalytics(ctx context.Context, proposalID string) (*ProposalAnalytics, error) {
+	info, err := s.repo.GetProposalInfo(ctx, proposalID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline, err := s.repo.GetProposalVotesTimeline(ctx, info.DaoID, proposalID)
+	if err != nil {
+		return nil, err
+	}
+
+	choices, err := s.repo.GetProposalChoices(ctx, info.DaoID, proposalID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Unix(info.Start, 0).UTC()
+	end := time.Unix(info.End, 0).UTC()
+	totals, err := s.repo.GetProposalVpTotals(ctx, info.DaoID, proposalID, end.Add(-proposalFinalPeriod), info.Quorum)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ProposalAnalytics{
+		ProposalID: proposalID,
+		DaoID:      info.DaoID,
+		Start:      start,
+		End:        end,
+		Quorum:     info.Quorum,
+		Timeline:   cumulativeTimeline(timeline, start, end),
+		Choices:    choices,
+	}
+	if totals == nil {
+		return res, nil
+	}
+
+	if info.Quorum > 0 && totals.QuorumReachedAt != nil {
+		ttq := max(totals.QuorumReachedAt.Sub(start), 0)
+		res.TimeToQuorum = &ttq
+	}
+	if totals.Vp > 0 {
+		res.FinalDayVpShare = totals.FinalPeriodVp / totals.Vp
+	}
+
+	return res, nil
+}
+
+func (s *Service) GetVoterProfile(ctx context.Context, voter string) (*VoterProfile, error) {
+	daos, err := s.repo.GetVoterDaos(ctx, voter)
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := s.repo.GetVoterMonthlyActivity(ctx, voter)
+	if err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	res := make([]*VoterDao, len(daos))
+	for i, d := range daos {
+		dao := *d
+		total += dao.Votes
+		if dao.Proposals > 0 {
+			// votes for proposals which aren't stored yet may exceed proposals
+			dao.ParticipationRate = min(float64(dao.Votes)/float64(dao.Proposals), 1)
+		}
+		res[i] = &dao
+	}
+
+	return &VoterProfile{
+		Voter:           voter,
+		TotalVotes:      total,
+		Daos:            res,
+		MonthlyActivity: activity,
+	}, nil
+}
+
+// GetVoterRetentionCohorts returns the cohort matrix for the last months (all history if months is 0).
+// Months without new voters are omitted.
+func (s *Service) GetVoterRetentionCohorts(ctx context.Context, id uuid.UUID, months uint32) ([]*RetentionCohort, error) {
+	cells, err := s.repo.GetVoterRetention(ctx, id, months)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	res := make([]*RetentionCohort, 0)
+	var cohort *RetentionCohort
+	for _, cell := range cells {
+		if cohort == nil || !cohort.Cohort.Equal(cell.Cohort) {
+			cohort = &RetentionCohort{
+				Cohort: cell.Cohort,
+				Active: make([]uint64, max(monthsBetween(cell.Cohort, currentMonth), 0)+1),
+			}
+			res = append(res, cohort)
+		}
+
+		offset := monthsBetween(cell.Cohort, cell.PeriodStarted)
+		if offset < 0 || offset >= len(cohort.Active) {
+			continue
+		}
+		cohort.Active[offset] = cell.Voters
+	}
+
+	for _, c := range res {
+		c.Size = c.Active[0]
+	}
+
+	return res, nil
+}
+
+func (s *Service) GetVpConcentration(ctx context.Context, id uuid.UUID, period uint32) (*VpConcentrationReport, error) {
+	current, err := s.repo.GetVpConcentration(ctx, id, period)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetMonthlyVpConcentration(ctx, id, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VpConcentrationReport{
+		Current: current,
+		History: history,
 	}, nil
 }
 
-func (s *Service) GetMonthlyDaos() ([]*MonthlyTotal, error) {
-	return s.repo.GetMonthlyDaos()
+// GetWhaleDecidedProposals returns proposals whose winner changes without votes of the top 1 or top 3 voters by vp
+// and monthly shares of such proposals by the end of voting
+func (s *Service) GetWhaleDecidedProposals(ctx context.Context, id uuid.UUID) (*WhaleDecidedReport, error) {
+	outcomes, err := s.repo.GetProposalOutcomes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &WhaleDecidedReport{
+		Proposals: make([]*WhaleDecidedProposal, 0),
+		History:   make([]*WhaleDecidedMonth, 0),
+	}
+	var month *WhaleDecidedMonth
+	for _, o := range outcomes {
+		p := &WhaleDecidedProposal{
+			ProposalID:    o.ProposalID,
+			EndAt:         o.EndAt,
+			Winner:        o.Winner,
+			DecidedByTop1: decidedBy(o.Winner, o.WinnerWithoutTop1),
+			DecidedByTop3: decidedBy(o.Winner, o.WinnerWithoutTop3),
+		}
+
+		periodStarted := time.Date(o.EndAt.Year(), o.EndAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if month == nil || !month.PeriodStarted.Equal(periodStarted) {
+			month = &WhaleDecidedMonth{PeriodStarted: periodStarted}
+			res.History = append(res.History, month)
+		}
+		month.Proposals++
+
+		if p.DecidedByTop1 {
+			month.DecidedByTop1++
+		}
+		if p.DecidedByTop3 {
+			month.DecidedByTop3++
+		}
+		if p.DecidedByTop1 || p.DecidedByTop3 {
+			res.Proposals = append(res.Proposals, p)
+		}
+	}
+
+	for _, m := range res.History {
+		m.Top1Share = float64(m.DecidedByTop1) / float64(m.Proposals)
+		m.Top3Share = float64(m.DecidedByTop3) / float64(m.Proposals)
+	}
+
+	return res, nil
+}
+
+// decidedBy checks that the winner changes without votes of the top voters. Proposals without other votes
+// aren't decided by the top voters, there is no outcome to compare with.
+func decidedBy(winner, winnerWithoutTop string) bool {
+	return winnerWithoutTop != "" && winnerWithoutTop != winner
 }
 
-func (s *Service) GetMonthlyProposals() ([]*MonthlyTotal, error) {
-	return s.repo.GetMonthlyProposals()
+func (s *Service) GetTopDelegates(ctx context.Context, id uuid.UUID, offset uint32, limit uint32) ([]*Delegate, error) {
+	return s.repo.GetTopDelegates(ctx, id, int(limit), int(offset))
 }
 
-func (s *Service) GetMonthlyVoters() ([]*MonthlyTotal, error) {
-	return s.repo.GetMonthlyVoters()
+func (s *Service) GetDelegatedVp(ctx context.Context, id uuid.UUID, period uint32) (*DelegatedVp, error) {
+	res, err := s.repo.GetDelegatedVp(ctx, id, period)
+	if err != nil || res == nil {
+		return res, err
+	}
+
+	// the result could be shared by the cache, so it isn't modified
+	out := *res
+	if out.TotalVp > 0 {
+		out.Share = out.DelegatedVp / out.TotalVp
+	}
+
+	return &out, nil
 }
 
-func (s *Service) GetTopDaos(category string, interval string, pricePeriod string) ([]*TopDao, error) {
-	return s.repo.GetTopDaos(category, interval, pricePeriod)
+func (s *Service) GetQuorumStats(ctx context.Context, id uuid.UUID, period uint32) (*QuorumStats, error) {
+	proposals, err := s.repo.GetQuorumProposals(ctx, id, period)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QuorumStats{
+		Proposals: make([]*QuorumProposal, len(proposals)),
+	}
+	if len(proposals) == 0 {
+		return res, nil
+	}
+
+	var (
+		turnout       float64
+		reached       int
+		failed        int
+		timesToQuorum = make([]time.Duration, 0, len(proposals))
+		now           = time.Now()
+	)
+	for i, qp := range proposals {
+		p := *qp
+		res.Proposals[i] = &p
+
+		p.Turnout = p.ScoresTotal / p.Quorum
+		p.FailedByQuorum = failedByQuorum(&p, now)
+		if p.QuorumReachedAt != nil {
+			ttq := max(p.QuorumReachedAt.Sub(p.Start), 0)
+			p.TimeToQuorum = &ttq
+			timesToQuorum = append(timesToQuorum, ttq)
+		}
+
+		turnout += p.Turnout
+		if p.ScoresTotal >= p.Quorum {
+			reached++
+		}
+		if p.FailedByQuorum {
+			failed++
+		}
+	}
+
+	res.AvgTurnout = turnout / float64(len(proposals))
+	res.ReachedQuorumShare = float64(reached) / float64(len(proposals))
+	res.FailedByQuorumShare = float64(failed) / float64(len(proposals))
+	if len(timesToQuorum) > 0 {
+		slices.Sort(timesToQuorum)
+		median := timesToQuorum[len(timesToQuorum)/2]
+		if len(timesToQuorum)%2 == 0 {
+			median = (timesToQuorum[len(timesToQuorum)/2-1] + median) / 2
+		}
+		res.MedianTimeToQuorum = &median
+	}
+
+	return res, nil
+}
+
+// failedByQuorum checks that the closed proposal isn't succeeded only because of the quorum: basic proposals
+// would have passed with more votes for than against, other types with any winning choice
+func failedByQuorum(p *QuorumProposal, now time.Time) bool {
+	if p.State == "succeeded" || p.End.After(now) || p.ScoresTotal >= p.Quorum {
+		return false
+	}
+
+	if p.Type == "basic" {
+		return len(p.Scores) >= 2 && p.Scores[0] > p.Scores[1]
+	}
+
+	return slices.ContainsFunc(p.Scores, func(score float32) bool { return score > 0 })
+}
+
+func (s *Service) GetTopAuthors(ctx context.Context, id uuid.UUID, period uint32, offset uint32, limit uint32) ([]*DaoAuthor, error) {
+	authors, err := s.repo.GetTopAuthors(ctx, id, period, int(limit), int(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*DaoAuthor, len(authors))
+	for i, a := range authors {
+		author := *a
+		author.calculateRates()
+		res[i] = &author
+	}
+
+	return res, nil
+}
+
+// GetAuthorActivity returns proposals of the author in all daos
+func (s *Service) GetAuthorActivity(ctx context.Context, author string) ([]*AuthorDao, error) {
+	daos, err := s.repo.GetAuthorDaos(ctx, author)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*AuthorDao, len(daos))
+	for i, d := range daos {
+		dao := *d
+		dao.calculateRates()
+		res[i] = &dao
+	}
+
+	return res, nil
+}
+
+func (s *Service) GetVotingAppShare(ctx context.Context, id uuid.UUID, period uint32) ([]*MonthlyAppShare, error) {
+	votes, err := s.repo.GetMonthlyVotingApps(ctx, id, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertAppVotesToShares(votes), nil
+}
+
+func (s *Service) GetEcosystemVotingAppShare(ctx context.Context, period uint32) ([]*MonthlyAppShare, error) {
+	return s.GetVotingAppShare(ctx, uuid.Nil, period)
+}
+
+// convertAppVotesToShares groups app votes ordered by month into months
+func convertAppVotesToShares(votes []*AppVotes) []*MonthlyAppShare {
+	res := make([]*MonthlyAppShare, 0)
+	var month *MonthlyAppShare
+	for _, v := range votes {
+		if month == nil || !month.PeriodStarted.Equal(v.PeriodStarted) {
+			month = &MonthlyAppShare{PeriodStarted: v.PeriodStarted}
+			res = append(res, month)
+		}
+
+		month.Votes += v.Votes
+		month.Apps = append(month.Apps, &AppShare{
+			App:    v.App,
+			Votes:  v.Votes,
+			Voters: v.Voters,
+		})
+	}
+
+	for _, m := range res {
+		if m.Votes == 0 {
+			continue
+		}
+
+		for _, app := range m.Apps {
+			app.VotesShare = float64(app.Votes) / float64(m.Votes)
+			if app.App == GoverlandApp {
+				m.GoverlandVotesShare = app.VotesShare
+			}
+		}
+	}
+
+	return res
+}
+
+// GetStrategyBreakdown returns vp by strategies of the dao, or of the proposal if proposalID isn't empty
+func (s *Service) GetStrategyBreakdown(ctx context.Context, id uuid.UUID, proposalID string, period uint32) (*StrategyBreakdown, error) {
+	vps, err := s.repo.GetMonthlyStrategyVp(ctx, id, proposalID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &StrategyBreakdown{
+		Total:   make([]*StrategyShare, 0),
+		History: make([]*MonthlyStrategyShare, 0),
+	}
+	totals := make(map[string]*StrategyShare)
+	var (
+		month   *MonthlyStrategyShare
+		totalVp float64
+	)
+	for _, v := range vps {
+		if month == nil || !month.PeriodStarted.Equal(v.PeriodStarted) {
+			month = &MonthlyStrategyShare{PeriodStarted: v.PeriodStarted}
+			res.History = append(res.History, month)
+		}
+		month.Vp += v.Vp
+		month.Strategies = append(month.Strategies, &StrategyShare{
+			Strategy: v.Strategy,
+			Vp:       v.Vp,
+		})
+
+		total, ok := totals[v.Strategy]
+		if !ok {
+			total = &StrategyShare{Strategy: v.Strategy}
+			totals[v.Strategy] = total
+			res.Total = append(res.Total, total)
+		}
+		total.Vp += v.Vp
+		totalVp += v.Vp
+	}
+
+	for _, m := range res.History {
+		if m.Vp == 0 {
+			continue
+		}
+		for _, st := range m.Strategies {
+			st.Share = st.Vp / m.Vp
+		}
+	}
+
+	slices.SortFunc(res.Total, func(a, b *StrategyShare) int {
+		return cmp.Compare(b.Vp, a.Vp)
+	})
+	if totalVp > 0 {
+		for _, st := range res.Total {
+			st.Share = st.Vp / totalVp
+		}
+	}
+
+	return res, nil
+}
+
+// GetTopVotersByVpPage returns voters of the dao ordered by average vp, votes and the last vote
+func (s *Service) GetTopVotersByVpPage(ctx context.Context, id uuid.UUID, period uint32, cursor string, limit uint32) (*Page[*VoterWithVp], error) {
+	page, _, err := readPage(cursor, topVotersList, fmt.Sprintf("%s:%d", id, period), limit, defaultListLimit,
+		func(asOf time.Time) (uint64, error) {
+			return s.repo.GetVotersCount(ctx, id, period, asOf)
+		},
+		func(asOf time.Time, after *RankKey, limit int) ([]*RankedVoter, error) {
+			return s.repo.GetTopVotersByVpAfter(ctx, id, period, asOf, after, limit)
+		},
+		func(v *RankedVoter) RankKey {
+			return RankKey{Value: v.VpAvg, Count: uint64(v.VotesCount), Time: v.LastVote, ID: v.Voter}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Page[*VoterWithVp]{
+		Items:      make([]*VoterWithVp, len(page.Items)),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	for i, v := range page.Items {
+		res.Items[i] = &v.VoterWithVp
+	}
+
+	return res, nil
+}
+
+// GetMutualDaosPage returns other daos ordered by voters of the dao who vote there. The requested dao isn't
+// in the list, VotersPercent is relative to its voters. The whole list is returned without the limit and cursor.
+func (s *Service) GetMutualDaosPage(ctx context.Context, id uuid.UUID, cursor string, limit uint32) (*Page[*MutualDao], error) {
+	page, _, err := readPage(cursor, mutualDaosList, id.String(), limit, wholeList,
+		func(asOf time.Time) (uint64, error) {
+			return s.repo.GetMutualDaosCount(ctx, id, asOf)
+		},
+		func(asOf time.Time, after *RankKey, limit int) ([]*RankedMutualDao, error) {
+			return s.repo.GetMutualDaosAfter(ctx, id, asOf, after, limit)
+		},
+		func(d *RankedMutualDao) RankKey {
+			return RankKey{Count: uint64(d.VotersCount), ID: d.DaoID.String()}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Page[*MutualDao]{
+		Items:      make([]*MutualDao, len(page.Items)),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	for i, d := range page.Items {
+		res.Items[i] = &MutualDao{
+			DaoID:       d.DaoID,
+			VotersCount: d.VotersCount,
+		}
+		if d.RequestedDaoVoters > 0 {
+			res.Items[i].VotersPercent = float32(d.VotersCount) / float32(d.RequestedDaoVoters) * 100.0
+		}
+	}
+
+	return res, nil
+}
+
+// GetTopDaosPage returns top daos ordered by average vp in usd, Index is the position in the whole list.
+// The whole list is returned without the limit and cursor.
+func (s *Service) GetTopDaosPage(ctx context.Context, category string, interval string, pricePeriod string, cursor string, limit uint32) (*Page[*TopDao], error) {
+	page, position, err := readPage(cursor, topDaosList, fmt.Sprintf("%s:%s:%s", category, interval, pricePeriod), limit, wholeList,
+		func(asOf time.Time) (uint64, error) {
+			return s.repo.GetTopDaosCount(ctx, category, interval, pricePeriod, asOf)
+		},
+		func(asOf time.Time, after *RankKey, limit int) ([]*TopDao, error) {
+			return s.repo.GetTopDaosAfter(ctx, category, interval, pricePeriod, asOf, after, limit)
+		},
+		func(d *TopDao) RankKey {
+			return RankKey{Value: d.AvpUsd, ID: d.DaoID.String()}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*TopDao, len(page.Items))
+	for i, d := range page.Items {
+		dao := *d
+		dao.Index = uint32(position) + uint32(i) + 1
+		items[i] = &dao
+	}
+	page.Items = items
+
+	return page, nil
+}
+
+// readPage reads the page of the ranked list after the cursor and returns it with the position of its first
+// row. The first page fixes the snapshot time and counts the total, next pages take them from the cursor.
+// Unset limit means defaultLimit, lists which were returned whole before pagination use wholeList to keep
+// returning the whole list for requests without the limit and cursor.
+func readPage[R any](
+	token, list, scope string,
+	limit, defaultLimit uint32,
+	count func(asOf time.Time) (uint64, error),
+	load func(asOf time.Time, after *RankKey, limit int) ([]R, error),
+	key func(R) RankKey,
+) (*Page[R], uint64, error) {
+	var v validator
+	v.limit(uint64(limit))
+	if err := v.err(); err != nil {
+		return nil, 0, err
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	cursor, err := decodeCursor(token, list, scope)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit == wholeList {
+		if cursor == nil {
+			rows, err := load(time.Now().UTC(), nil, math.MaxInt32)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			return &Page[R]{Items: rows, Total: uint64(len(rows))}, 0, nil
+		}
+
+		limit = defaultListLimit
+	}
+	if cursor == nil {
+		cursor = &pageCursor{
+			List:  list,
+			Scope: scope,
+			AsOf:  time.Now().UTC().Truncate(pageSnapshotPrecision),
+		}
+		if cursor.Total, err = count(cursor.AsOf); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var after *RankKey
+	if cursor.Position > 0 {
+		after = &cursor.Key
+	}
+
+	// one more row is read to know if there is the next page
+	rows, err := load(cursor.AsOf, after, int(limit)+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page := &Page[R]{
+		Items: rows,
+		Total: cursor.Total,
+	}
+	if len(rows) > int(limit) {
+		page.Items = rows[:limit]
+
+		next := *cursor
+		next.Position += uint64(limit)
+		next.Key = key(page.Items[limit-1])
+		page.NextCursor = encodeCursor(next)
+	}
+
+	return page, cursor.Position, nil
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+// cumulativeTimeline fills hours from the start to the end (or now for active proposals) with cumulative values
+func cumulativeTimeline(buckets []*ProposalVotesBucket, start, end time.Time) []*ProposalVotesBucket {
+	from := start.Truncate(time.Hour)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	if end.Before(from) {
+		end = from
+	}
+
+	res := make([]*ProposalVotesBucket, 0, int(end.Sub(from)/time.Hour)+1)
+	var (
+		voters uint64
+		vp     float64
+		i      int
+	)
+	for hour := from; !hour.After(end); hour = hour.Add(time.Hour) {
+		for ; i < len(buckets) && !buckets[i].PeriodStarted.After(hour); i++ {
+			voters += buckets[i].Voters
+			vp += buckets[i].Vp
+		}
+
+		res = append(res, &ProposalVotesBucket{
+			PeriodStarted: hour,
+			Voters:        voters,
+			Vp:            vp,
+		})
+	}
+
+	// votes received after the end are counted in the last hour
+	last := res[len(res)-1]
+	for ; i < len(buckets); i++ {
+		last.Voters += buckets[i].Voters
+		last.Vp += buckets[i].Vp
+	}
+
+	return res
 }
 
 func (s *Service) processPopularityIndexCalculation(ctx context.Context) error {
-	daos, err := s.repo.GetDaos()
+	daos, err := s.repo.GetDaos(ctx)
 	if err != nil {
 		return err
 	}
 
-	dp, err := s.repo.GetDaoProposalForPeriod(popularDaoIndexCalculationPeriod)
+	dp, err := s.repo.GetDaoProposalForPeriod(ctx, popularDaoIndexCalculationPeriod)
 	if err != nil {
 		return err
 	}
 
-	dv, err := s.repo.GetDaoVotersForPeriod(popularDaoIndexCalculationPeriod)
+	dv, err := s.repo.GetDaoVotersForPeriod(ctx, popularDaoIndexCalculationPeriod)
 	if err != nil {
 		return err
 	}
 
-	dvo, err := s.repo.GetDaoVotersForPeriod(0)
+	dvo, err := s.repo.GetDaoVotersForPeriod(ctx, 0)
 	if err != nil {
 		return err
 	}
 
-	dvs, err := s.repo.GetDaoVotesForPeriod(popularDaoIndexCalculationPeriod)
+	dvs, err := s.repo.GetDaoVotesForPeriod(ctx, popularDaoIndexCalculationPeriod)
 	if err != nil {
 		return err
 	}
 
-	dvso, err := s.repo.GetDaoVotesForPeriod(0)
+	dvso, err := s.repo.GetDaoVotesForPeriod(ctx, 0)
 	if err != nil {
 		return err
 	}
 
-	dadditives, err := s.repo.GetGoverlandIndexAdditives()
+	dadditives, err := s.repo.GetGoverlandIndexAdditives(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,96 @@
+package item
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFailedByQuorum(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	closed := now.Add(-time.Hour)
+
+	for name, tc := range map[string]struct {
+		proposal QuorumProposal
+		want     bool
+	}{
+		"basic with more votes for": {
+			proposal: QuorumProposal{State: "failed", Type: "basic", End: closed, Quorum: 100, ScoresTotal: 50, Scores: []float32{40, 10}},
+			want:     true,
+		},
+		"basic with more votes against": {
+			proposal: QuorumProposal{State: "failed", Type: "basic", End: closed, Quorum: 100, ScoresTotal: 50, Scores: []float32{10, 40}},
+		},
+		"single choice with votes": {
+			proposal: QuorumProposal{State: "failed", Type: "single-choice", End: closed, Quorum: 100, ScoresTotal: 50, Scores: []float32{0, 50}},
+			want:     true,
+		},
+		"single choice without votes": {
+			proposal: QuorumProposal{State: "failed", Type: "single-choice", End: closed, Quorum: 100, Scores: []float32{0, 0}},
+		},
+		"quorum is reached": {
+			proposal: QuorumProposal{State: "defeated", Type: "basic", End: closed, Quorum: 100, ScoresTotal: 150, Scores: []float32{100, 50}},
+		},
+		"succeeded": {
+			proposal: QuorumProposal{State: "succeeded", Type: "basic", End: closed, Quorum: 100, ScoresTotal: 50, Scores: []float32{40, 10}},
+		},
+		"not closed": {
+			proposal: QuorumProposal{State: "failed", Type: "basic", End: now.Add(time.Hour), Quorum: 100, ScoresTotal: 50, Scores: []float32{40, 10}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := failedByQuorum(&tc.proposal, now); got != tc.want {
+				t.Fatalf("failed by quorum: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type outcomesProvider struct {
+	DataProvider
+
+	outcomes []*ProposalOutcome
+}
+
+func (p *outcomesProvider) GetProposalOutcomes(context.Context, uuid.UUID) ([]*ProposalOutcome, error) {
+	return p.outcomes, nil
+}
+
+func TestGetWhaleDecidedProposals(t *testing.T) {
+	endAt := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	outcomes := []*ProposalOutcome{
+		{ProposalID: "top1", EndAt: endAt, Winner: "1", WinnerWithoutTop1: "2", WinnerWithoutTop3: "2"},
+		{ProposalID: "top3", EndAt: endAt, Winner: "1", WinnerWithoutTop1: "1", WinnerWithoutTop3: "2"},
+		{ProposalID: "not decided", EndAt: endAt, Winner: "1", WinnerWithoutTop1: "1", WinnerWithoutTop3: "1"},
+		{ProposalID: "single voter", EndAt: endAt, Winner: "1"},
+		{ProposalID: "two voters", EndAt: endAt, Winner: "1", WinnerWithoutTop1: "1"},
+	}
+
+	s, err := NewService(nil, &outcomesProvider{outcomes: outcomes})
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+
+	res, err := s.GetWhaleDecidedProposals(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+
+	got := make(map[string][2]bool)
+	for _, p := range res.Proposals {
+		got[p.ProposalID] = [2]bool{p.DecidedByTop1, p.DecidedByTop3}
+	}
+	want := map[string][2]bool{"top1": {true, true}, "top3": {false, true}}
+	if len(got) != len(want) || got["top1"] != want["top1"] || got["top3"] != want["top3"] {
+		t.Fatalf("decided proposals: got %v, want %v", got, want)
+	}
+
+	if len(res.History) != 1 {
+		t.Fatalf("history: %+v", res.History)
+	}
+	if m := res.History[0]; m.Proposals != 5 || m.DecidedByTop1 != 1 || m.DecidedByTop3 != 2 {
+		t.Fatalf("month: %+v", m)
+	}
+}
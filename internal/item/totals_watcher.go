@@ -0,0 +1,145 @@
+package item
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/storage"
+)
+
+const (
+	totalsWatcherInterval = 30 * time.Second
+)
+
+// TotalsWatcher pushes ecosystem totals to watchers after storage commits. Commits are coalesced: totals are
+// recalculated not more often than once per interval and only while somebody watches.
+type TotalsWatcher struct {
+	service *Service
+	changed chan struct{}
+
+	mu   sync.Mutex
+	subs map[*totalsSubscription]struct{}
+}
+
+type totalsSubscription struct {
+	period  uint32
+	updates chan *EcosystemTotals
+}
+
+func NewTotalsWatcher(s *Service) *TotalsWatcher {
+	return &TotalsWatcher{
+		service: s,
+		changed: make(chan struct{}, 1),
+		subs:    make(map[*totalsSubscription]struct{}),
+	}
+}
+
+// OnCommit is the storage worker callback
+func (w *TotalsWatcher) OnCommit(groups map[uint32]storage.GroupState) {
+	for _, state := range groups {
+		if state != storage.Committed {
+			continue
+		}
+
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+
+		return
+	}
+}
+
+// Watch sends current totals for the period and then sends updated totals after commits until the context
+// is done or send fails. Slow watchers skip intermediate updates.
+// The subscription is registered before the current totals are calculated, so commits made meanwhile aren't missed.
+func (w *TotalsWatcher) Watch(ctx context.Context, period uint32, send func(*EcosystemTotals) error) error {
+	sub := &totalsSubscription{
+		period:  period,
+		updates: make(chan *EcosystemTotals, 1),
+	}
+	w.mu.Lock()
+	w.subs[sub] = struct{}{}
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		delete(w.subs, sub)
+		w.mu.Unlock()
+	}()
+
+	totals, err := w.service.GetCurrentTotalsForLastPeriods(ctx, period)
+	if err != nil {
+		return err
+	}
+	if err = send(totals); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case totals = <-sub.updates:
+			if err = send(totals); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *TotalsWatcher) Process(ctx context.Context) error {
+	ticker := time.NewTicker(totalsWatcherInterval)
+	defer ticker.Stop()
+
+	changed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.changed:
+			changed = true
+		case <-ticker.C:
+			if changed && w.publish(ctx) {
+				changed = false
+			}
+		}
+	}
+}
+
+// publish calculates totals for periods of current watchers, it returns false if there are no watchers
+func (w *TotalsWatcher) publish(ctx context.Context) bool {
+	w.mu.Lock()
+	byPeriod := make(map[uint32][]*totalsSubscription)
+	for sub := range w.subs {
+		byPeriod[sub.period] = append(byPeriod[sub.period], sub)
+	}
+	w.mu.Unlock()
+
+	if len(byPeriod) == 0 {
+		return false
+	}
+
+	for period, subs := range byPeriod {
+		totals, err := w.service.GetCurrentTotalsForLastPeriods(ctx, period)
+		if err != nil {
+			log.Error().Err(err).Uint32("period", period).Msg("calculate ecosystem totals")
+
+			continue
+		}
+
+		for _, sub := range subs {
+			// replace the update which isn't read yet
+			select {
+			case <-sub.updates:
+			default:
+			}
+			sub.updates <- totals
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,177 @@
+package item
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/goverland-labs/goverland-analytics-api-protocol/protobuf/internalapi"
+)
+
+const (
+	maxPeriodInMonths = 120
+	maxPeriodInDays   = 3650
+	maxListLimit      = 1000
+
+	// defaults of unset fields, unset period in months means the whole history
+	defaultPeriodInDays = 30
+	defaultListLimit    = 100
+)
+
+// validator collects violations of the request fields
+type validator struct {
+	violations []FieldViolation
+}
+
+func (v *validator) add(field, description string) {
+	v.violations = append(v.violations, FieldViolation{Field: field, Description: description})
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Violations: v.violations}
+}
+
+func (v *validator) daoID(value string) uuid.UUID {
+	if value == "" {
+		v.add("dao_id", "required")
+
+		return uuid.Nil
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		v.add("dao_id", "invalid uuid")
+	}
+
+	return id
+}
+
+func (v *validator) periodInMonths(value uint32) {
+	if value > maxPeriodInMonths {
+		v.add("period_in_months", fmt.Sprintf("must be at most %d", maxPeriodInMonths))
+	}
+}
+
+func (v *validator) periodInDays(value uint32) {
+	if value > maxPeriodInDays {
+		v.add("period_in_days", fmt.Sprintf("must be at most %d", maxPeriodInDays))
+	}
+}
+
+func (v *validator) limit(value uint64) {
+	if value > maxListLimit {
+		v.add("limit", fmt.Sprintf("must be at most %d", maxListLimit))
+	}
+}
+
+// periodInDays returns the default period for the unset one
+func periodInDays(value uint32) uint32 {
+	if value == 0 {
+		return defaultPeriodInDays
+	}
+
+	return value
+}
+
+// listLimit returns the default limit for the unset one
+func listLimit[T uint32 | uint64](value T) T {
+	if value == 0 {
+		return defaultListLimit
+	}
+
+	return value
+}
+
+func validateDaoPeriodRequest(daoID string, period uint32) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(daoID)
+	v.periodInMonths(period)
+
+	return id, v.err()
+}
+
+func validateDaoRequest(daoID string) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(daoID)
+
+	return id, v.err()
+}
+
+func validateVoterBucketsV2Request(req *internalapi.VoterBucketsRequestV2) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(req.GetDaoId())
+
+	if len(req.Groups) == 0 {
+		v.add("groups", "required")
+	}
+	for i := 1; i < len(req.Groups); i++ {
+		if req.Groups[i] <= req.Groups[i-1] {
+			v.add("groups", "must be strictly ascending")
+
+			break
+		}
+	}
+
+	return id, v.err()
+}
+
+func validateTopVotersByVpRequest(req *internalapi.TopVotersByVpRequest) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(req.GetDaoId())
+	v.periodInMonths(req.GetPeriodInMonths())
+	v.limit(uint64(req.GetLimit()))
+
+	return id, v.err()
+}
+
+func validateDaosVotersParticipateInRequest(req *internalapi.DaosVotersParticipateInRequest) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(req.GetDaoId())
+	v.limit(req.GetLimit())
+
+	return id, v.err()
+}
+
+func validateTotalsForLastPeriodsRequest(req *internalapi.TotalsForLastPeriodsRequest) error {
+	var v validator
+	v.periodInDays(req.GetPeriodInDays())
+
+	return v.err()
+}
+
+func validateMonthlyActiveRequest(req *internalapi.MonthlyActiveRequest) error {
+	var v validator
+	switch req.Type {
+	case internalapi.ObjectType_OBJECT_TYPE_DAO, internalapi.ObjectType_OBJECT_TYPE_PROPOSAL, internalapi.ObjectType_OBJECT_TYPE_VOTER:
+	default:
+		v.add("type", "unsupported object type")
+	}
+
+	return v.err()
+}
+
+func validateAvgVpListRequest(req *internalapi.GetAvgVpListRequest) (uuid.UUID, error) {
+	var v validator
+	id := v.daoID(req.GetDaoId())
+	v.periodInMonths(req.GetPeriodInMonths())
+
+	minBalance := float64(req.GetMinBalance())
+	if minBalance < 0 || math.IsNaN(minBalance) || math.IsInf(minBalance, 0) {
+		v.add("min_balance", "must be a non-negative number")
+	}
+
+	return id, v.err()
+}
+
+func validateTopDaosRequest(req *internalapi.GetTopDaosRequest) error {
+	var v validator
+	if _, ok := Intervals[req.GetInterval()]; !ok && req.GetInterval() != "" {
+		v.add("interval", "unsupported interval")
+	}
+
+	return v.err()
+}
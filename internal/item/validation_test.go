@@ -0,0 +1,148 @@
+package item
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/goverland-labs/goverland-analytics-api-protocol/protobuf/internalapi"
+)
+
+// violatedFields returns fields of the validation error, nil error has no fields
+func violatedFields(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("not a validation error: %v", err)
+	}
+
+	fields := make([]string, len(validationErr.Violations))
+	for i, v := range validationErr.Violations {
+		fields[i] = v.Field
+	}
+
+	return fields
+}
+
+func TestValidateDaoPeriodRequest(t *testing.T) {
+	daoID := uuid.New()
+
+	for name, tc := range map[string]struct {
+		daoID  string
+		period uint32
+		want   []string
+	}{
+		"valid":                {daoID: daoID.String(), period: 12},
+		"whole history":        {daoID: daoID.String(), period: 0},
+		"max period":           {daoID: daoID.String(), period: maxPeriodInMonths},
+		"missing dao":          {period: 12, want: []string{"dao_id"}},
+		"invalid dao":          {daoID: "dao", want: []string{"dao_id"}},
+		"too long period":      {daoID: daoID.String(), period: maxPeriodInMonths + 1, want: []string{"period_in_months"}},
+		"all fields are wrong": {daoID: "dao", period: maxPeriodInMonths + 1, want: []string{"dao_id", "period_in_months"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			id, err := validateDaoPeriodRequest(tc.daoID, tc.period)
+			if got := violatedFields(t, err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("violations: got %v, want %v", got, tc.want)
+			}
+			if err == nil && id != daoID {
+				t.Fatalf("dao id: %s", id)
+			}
+		})
+	}
+}
+
+func TestValidateTopVotersByVpRequest(t *testing.T) {
+	daoID := uuid.NewString()
+
+	for name, tc := range map[string]struct {
+		limit uint32
+		want  []string
+	}{
+		"unset limit":     {limit: 0},
+		"max limit":       {limit: maxListLimit},
+		"too large limit": {limit: maxListLimit + 1, want: []string{"limit"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := &internalapi.TopVotersByVpRequest{}
+			req.DaoId = daoID
+			req.Limit = tc.limit
+
+			_, err := validateTopVotersByVpRequest(req)
+			if got := violatedFields(t, err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("violations: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateTotalsForLastPeriodsRequest(t *testing.T) {
+	for name, tc := range map[string]struct {
+		period uint32
+		want   []string
+	}{
+		"unset period":    {period: 0},
+		"max period":      {period: maxPeriodInDays},
+		"too long period": {period: maxPeriodInDays + 1, want: []string{"period_in_days"}},
+		"one day period":  {period: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := &internalapi.TotalsForLastPeriodsRequest{}
+			req.PeriodInDays = tc.period
+
+			err := validateTotalsForLastPeriodsRequest(req)
+			if got := violatedFields(t, err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("violations: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateVoterBucketsV2Request(t *testing.T) {
+	daoID := uuid.NewString()
+
+	for name, tc := range map[string]struct {
+		groups []uint32
+		want   []string
+	}{
+		"ascending groups":     {groups: []uint32{1, 2, 5}},
+		"single group":         {groups: []uint32{3}},
+		"missing groups":       {want: []string{"groups"}},
+		"not ascending groups": {groups: []uint32{1, 5, 2}, want: []string{"groups"}},
+		"repeated groups":      {groups: []uint32{1, 1}, want: []string{"groups"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := &internalapi.VoterBucketsRequestV2{}
+			req.DaoId = daoID
+			req.Groups = tc.groups
+
+			_, err := validateVoterBucketsV2Request(req)
+			if got := violatedFields(t, err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("violations: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	for name, tc := range map[string]struct {
+		got, want uint64
+	}{
+		"unset limit":          {got: uint64(listLimit(uint32(0))), want: defaultListLimit},
+		"set limit":            {got: listLimit(uint64(5)), want: 5},
+		"unset period in days": {got: uint64(periodInDays(0)), want: defaultPeriodInDays},
+		"set period in days":   {got: uint64(periodInDays(7)), want: 7},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Fatalf("got %d, want %d", tc.got, tc.want)
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ func GetAllMigrations() []*Migration {
 		NewMigration(6, Migration006AddGoverlandIndexAdditive),
 		NewMigration(7, Migration007TokenPriceTable),
 		NewMigration(8, Migration008AddWhitelistDao),
+		NewMigration(9, Migration009AddEventID),
+		NewMigration(10, Migration010AddDelegations),
 	}
 }
 
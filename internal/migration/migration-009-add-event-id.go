@@ -0,0 +1,284 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	replacingMergeTree = "ReplacingMergeTree"
+	// PrepareDedupCommand copies raw tables before the migration 009, see PrepareDedupTables
+	PrepareDedupCommand = "prepare-dedup"
+)
+
+// dedupTable is the raw table rebuilt as ReplacingMergeTree. Tables are partitioned by month: duplicates of the event
+// have the same created_at, so FINAL doesn't merge across partitions and skips merged ones.
+type dedupTable struct {
+	name   string
+	create string
+	// columns are copied as is, the event id is calculated by eventID from them
+	columns string
+	eventID string
+}
+
+// Keys of existing rows are calculated by the same formulas as vote.EventID and proposal.EventID.
+var dedupTables = []dedupTable{
+	{
+		name: "votes_raw",
+		create: `create table if not exists votes_raw_dedup (
+			dao_id		    UUID,
+			created_day     Date default toDate(created_at),
+			created_at      DateTime,
+			proposal_id     String,
+			voter		    String,
+			app				String,
+			choice			String,
+			vp				Float64,
+			vp_by_strategy  Array(Float64),
+			vp_state		String,
+			event_id		String
+		) ENGINE = ReplacingMergeTree PARTITION BY toYYYYMM(created_day) ORDER BY (dao_id, proposal_id, created_day, event_id)`,
+		columns: "dao_id, created_day, created_at, proposal_id, voter, app, choice, vp, vp_by_strategy, vp_state",
+		eventID: `lower(hex(SHA256(concat(toString(dao_id), '|', proposal_id, '|', voter, '|', toString(toUnixTimestamp(created_at))))))`,
+	},
+	{
+		name: "proposals_raw",
+		create: `create table if not exists proposals_raw_dedup (
+			dao_id          UUID,
+			event_type      LowCardinality(String),
+			created_day     Date default toDate(created_at),
+			created_at      DateTime,
+			proposal_id     String,
+			network         LowCardinality(String),
+			strategies		String,
+			author			Nullable(String),
+			type			String,
+			title			Nullable(String),
+			body			Nullable(String),
+			choices			Array(String),
+			start			Int64,
+			end				Int64,
+			quorum			Float32,
+			state			LowCardinality(String),
+			scores			Array(Float32),
+			scores_state	String,
+			scores_total	Float32,
+			scores_updated	Int32,
+			votes			Int32,
+			event_time		DateTime default now(),
+			spam			Bool default false,
+			event_id		String
+		) ENGINE = ReplacingMergeTree PARTITION BY toYYYYMM(created_day) ORDER BY (dao_id, created_day, event_id)`,
+		columns: "dao_id, event_type, created_day, created_at, proposal_id, network, strategies, author, type, title, body, choices, start, end, quorum, state, scores, scores_state, scores_total, scores_updated, votes, event_time, spam",
+		eventID: `lower(hex(SHA256(concat(event_type, '|', proposal_id, '|', state, '|', toString(scores_updated), '|', toString(votes), '|',
+				toString(spam), '|', toString(toUnixTimestamp(created_at))))))`,
+	},
+}
+
+// Migration009AddEventID adds the idempotency key to votes and proposals tables and rebuilds them as ReplacingMergeTree
+// with the key in the sorting key, so redelivered events are collapsed on merges.
+// Existing rows are copied by the prepare-dedup command before the service is updated, the migration only copies
+// months written since then. Tables with rows which weren't prepared fail the migration, empty ones are rebuilt.
+// Materialized views on votes_raw are recreated to be attached to the new table, their aggregates
+// (uniq, min) aren't affected by duplicates.
+// The migration can be re-run after the partial failure: rebuilt tables are detected by their engine.
+func Migration009AddEventID(conn *gorm.DB) error {
+	for _, t := range dedupTables {
+		if err := checkPrepared(conn, t); err != nil {
+			return err
+		}
+	}
+
+	views := []string{"dao_voters_count_mv", "dao_voters_start_mv", "voters_monthly_count_mv", "voters_start_mv"}
+	for _, view := range views {
+		if err := conn.Exec(fmt.Sprintf("drop view if exists %s", view)).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, t := range dedupTables {
+		if err := rebuildAsReplacing(conn, t); err != nil {
+			return err
+		}
+	}
+
+	queries := []string{
+		`create MATERIALIZED VIEW if not exists dao_voters_count_mv to dao_voters_count AS
+			SELECT
+				dao_id,
+				toStartOfMonth(created_at) AS month_start,
+				uniqExactState(voter) as voters_count
+			from votes_raw
+			group by dao_id, month_start`,
+		`CREATE MATERIALIZED VIEW if not exists dao_voters_start_mv to dao_voters_start AS
+			SELECT
+				dao_id,
+				voter,
+				minState(created_at) as start_date
+			from votes_raw
+			group by dao_id, voter`,
+		`create MATERIALIZED VIEW if not exists voters_monthly_count_mv to voters_monthly_count AS
+			SELECT
+				toStartOfMonth(created_at) AS month_start,
+				uniqState(voter) as voters_count
+			from votes_raw
+			group by month_start`,
+		`CREATE MATERIALIZED VIEW if not exists voters_start_mv to voters_start AS
+			SELECT
+				voter,
+				minState(created_at) as start_date
+			from votes_raw
+			group by voter`,
+	}
+
+	for _, query := range queries {
+		if err := conn.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PrepareDedupTables copies raw tables to <table>_dedup tables month by month while the previous version of
+// the service is running. Copied months are replaced on the re-run, so the command can be restarted.
+func PrepareDedupTables(conn *gorm.DB) error {
+	for _, t := range dedupTables {
+		engine, err := tableEngine(conn, t.name)
+		if err != nil {
+			return err
+		}
+		if engine == replacingMergeTree {
+			continue
+		}
+
+		if err = conn.Exec(t.create).Error; err != nil {
+			return err
+		}
+
+		var months []uint32
+		err = conn.Raw(fmt.Sprintf("select distinct toYYYYMM(created_day) as month from %s order by month", t.name)).
+			Scan(&months).
+			Error
+		if err != nil {
+			return fmt.Errorf("months of %s: %w", t.name, err)
+		}
+
+		for i, month := range months {
+			if err = copyMonth(conn, t, month); err != nil {
+				return err
+			}
+
+			log.Info().Str("table", t.name).Uint32("month", month).Int("copied", i+1).Int("months", len(months)).
+				Msg("month is copied")
+		}
+	}
+
+	return nil
+}
+
+// rebuildAsReplacing copies months written since the table was prepared and exchanges the tables.
+// The table which already has the ReplacingMergeTree engine was rebuilt by the previous run.
+func rebuildAsReplacing(conn *gorm.DB, t dedupTable) error {
+	engine, err := tableEngine(conn, t.name)
+	if err != nil {
+		return err
+	}
+	if engine == replacingMergeTree {
+		return conn.Exec(fmt.Sprintf("drop table if exists %s_dedup", t.name)).Error
+	}
+
+	prepared, err := tableEngine(conn, t.name+"_dedup")
+	if err != nil {
+		return err
+	}
+
+	if prepared == "" {
+		if err = conn.Exec(t.create).Error; err != nil {
+			return err
+		}
+	} else {
+		// late events of the previous month could be written after it was copied
+		var months []uint32
+		err = conn.Raw(fmt.Sprintf(`select distinct toYYYYMM(created_day) as month from %s
+				where created_day >= (select toStartOfMonth(addMonths(max(created_day), -1)) from %s_dedup)
+				order by month`, t.name, t.name)).
+			Scan(&months).
+			Error
+		if err != nil {
+			return fmt.Errorf("months of %s: %w", t.name, err)
+		}
+
+		for _, month := range months {
+			if err = copyMonth(conn, t, month); err != nil {
+				return err
+			}
+		}
+	}
+
+	queries := []string{
+		fmt.Sprintf("exchange tables %s and %s_dedup", t.name, t.name),
+		fmt.Sprintf("drop table if exists %s_dedup", t.name),
+	}
+	for _, query := range queries {
+		if err = conn.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPrepared fails for the table with rows which wasn't copied by PrepareDedupTables
+func checkPrepared(conn *gorm.DB, t dedupTable) error {
+	engine, err := tableEngine(conn, t.name)
+	if err != nil || engine == replacingMergeTree {
+		return err
+	}
+
+	prepared, err := tableEngine(conn, t.name+"_dedup")
+	if err != nil || prepared != "" {
+		return err
+	}
+
+	var rows uint64
+	if err = conn.Raw(fmt.Sprintf("select count() from %s", t.name)).Scan(&rows).Error; err != nil {
+		return fmt.Errorf("rows of %s: %w", t.name, err)
+	}
+	if rows > 0 {
+		return fmt.Errorf("%s isn't prepared for deduplication, run the %s command first", t.name, PrepareDedupCommand)
+	}
+
+	return nil
+}
+
+// copyMonth replaces the month partition of the <table>_dedup table by rows of the table
+func copyMonth(conn *gorm.DB, t dedupTable, month uint32) error {
+	queries := []string{
+		fmt.Sprintf("alter table %s_dedup drop partition %d", t.name, month),
+		fmt.Sprintf("insert into %s_dedup (%s, event_id) select %s, %s from %s where toYYYYMM(created_day) = %d",
+			t.name, t.columns, t.columns, t.eventID, t.name, month),
+	}
+	for _, query := range queries {
+		if err := conn.Exec(query).Error; err != nil {
+			return fmt.Errorf("copy %d of %s: %w", month, t.name, err)
+		}
+	}
+
+	return nil
+}
+
+// tableEngine returns the engine of the table or the empty string if there is no table
+func tableEngine(conn *gorm.DB, table string) (string, error) {
+	var engine string
+	err := conn.Raw("select engine from system.tables where database = currentDatabase() and name = ?", table).
+		Scan(&engine).
+		Error
+	if err != nil {
+		return "", fmt.Errorf("engine of %s: %w", table, err)
+	}
+
+	return engine, nil
+}
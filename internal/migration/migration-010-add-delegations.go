@@ -0,0 +1,28 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+)
+
+func Migration010AddDelegations(conn *gorm.DB) error {
+	queries := []string{
+		`create table delegations_raw (
+			dao_id			UUID,
+			event_type		LowCardinality(String),
+			created_day		Date default toDate(created_at),
+			created_at		DateTime,
+			delegate		String,
+			delegator		String,
+			due_date		DateTime,
+			event_id		String
+		) ENGINE = ReplacingMergeTree ORDER BY (dao_id, delegate, delegator, event_id)`,
+	}
+
+	for _, query := range queries {
+		if err := conn.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
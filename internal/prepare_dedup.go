@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/migration"
+)
+
+// RunPrepareDedup copies votes and proposals tables for the migration 009 while the previous version of the service
+// is running, so the migration doesn't copy the whole history on the start of the service.
+func RunPrepareDedup(cfg config.App) error {
+	a := &Application{cfg: cfg}
+	if err := a.openClickhouse(); err != nil {
+		return err
+	}
+	defer a.clickhouseConn.Close()
+
+	if err := migration.PrepareDedupTables(a.db); err != nil {
+		return err
+	}
+
+	log.Info().Msg("tables are prepared for deduplication")
+
+	return nil
+}
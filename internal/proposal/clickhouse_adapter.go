@@ -1,6 +1,7 @@
 package proposal
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/goverland-labs/goverland-platform-events/events/core"
@@ -17,7 +18,7 @@ type ClickhouseAdapter struct {
 }
 
 func (c ClickhouseAdapter) GetInsertQuery() string {
-	return "INSERT INTO proposals_raw (dao_id, event_type, created_at, proposal_id, network, strategies, author, type, title, body, choices, start, end, quorum, state, scores, scores_state, scores_total, scores_updated, votes, spam) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return "INSERT INTO proposals_raw (dao_id, event_type, created_at, proposal_id, network, strategies, author, type, title, body, choices, start, end, quorum, state, scores, scores_state, scores_total, scores_updated, votes, spam, event_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 }
 
 func (c ClickhouseAdapter) Values(pl Payload) []any {
@@ -45,9 +46,25 @@ func (c ClickhouseAdapter) Values(pl Payload) []any {
 		int32(pl.Proposal.ScoresUpdated),
 		int32(pl.Proposal.Votes),
 		pl.Proposal.Spam,
+		EventID(pl),
 	}
 }
 
+// EventID returns the idempotency key of the proposal event: the same action with the same proposal state
+// has the same key. The key consists of stored columns only, so migration 009 computes the same key
+// for existing rows.
+func EventID(pl Payload) string {
+	return helpers.EventID(
+		pl.Action,
+		pl.Proposal.ID,
+		pl.Proposal.State,
+		strconv.Itoa(pl.Proposal.ScoresUpdated),
+		strconv.Itoa(pl.Proposal.Votes),
+		strconv.FormatBool(pl.Proposal.Spam),
+		strconv.Itoa(pl.Proposal.Created),
+	)
+}
+
 func (c ClickhouseAdapter) GetCategoryID(pl Payload) uint32 {
 	return pl.Proposal.DaoID.ID()
 }
@@ -0,0 +1,31 @@
+package proposal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/goverland-labs/goverland-platform-events/events/core"
+)
+
+// TestEventIDMatchesMigration keeps the key in sync with the backfill of migration 009:
+// lower(hex(SHA256(concat(event_type, '|', proposal_id, '|', state, '|', toString(scores_updated), '|',
+// toString(votes), '|', toString(spam), '|', toString(toUnixTimestamp(created_at))))))
+func TestEventIDMatchesMigration(t *testing.T) {
+	pl := Payload{
+		Action: "proposal_created",
+		Proposal: &core.ProposalPayload{
+			ID:            "0xabc",
+			State:         "active",
+			ScoresUpdated: 1700000100,
+			Votes:         42,
+			Spam:          true,
+			Created:       1700000000,
+		},
+	}
+
+	sum := sha256.Sum256([]byte("proposal_created|0xabc|active|1700000100|42|true|1700000000"))
+	if got, want := EventID(pl), hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("event id: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	adaptiveShrinkFactor = 0.5
+	adaptiveGrowFactor   = 1.25
+)
+
+// AdaptivePolicy sets bounds for the adaptive batching and the commit latency it keeps the batches under
+type AdaptivePolicy struct {
+	MinBatchSize        uint
+	MinBatchDuration    time.Duration
+	TargetCommitLatency time.Duration
+}
+
+// adaptiveBatching tunes the effective batch size and flush interval after each commit:
+//   - the batch size is halved when the commit takes longer than the target latency and grows by 25%
+//     when it takes less than half of it (AIMD, so the worker backs off quickly when clickhouse struggles)
+//   - the flush interval is the time needed to fill the batch at the observed inbound rate, so batches
+//     are flushed by size during spikes and by time when the inflow is low
+type adaptiveBatching struct {
+	policy           AdaptivePolicy
+	maxBatchSize     uint
+	maxBatchDuration time.Duration
+
+	mu            sync.Mutex
+	batchSize     uint
+	batchDuration time.Duration
+	inbound       uint64
+	lastObserved  time.Time
+}
+
+func newAdaptiveBatching(p AdaptivePolicy, maxBatchSize uint, maxBatchDuration time.Duration) *adaptiveBatching {
+	return &adaptiveBatching{
+		policy:           p,
+		maxBatchSize:     maxBatchSize,
+		maxBatchDuration: maxBatchDuration,
+		batchSize:        maxBatchSize,
+		batchDuration:    maxBatchDuration,
+		lastObserved:     time.Now(),
+	}
+}
+
+func (a *adaptiveBatching) addInbound(count int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inbound += uint64(count)
+}
+
+func (a *adaptiveBatching) current() (uint, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.batchSize, a.batchDuration
+}
+
+// observe recalculates the batch parameters by the latency of the last commit
+func (a *adaptiveBatching) observe(latency time.Duration) (uint, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case latency > a.policy.TargetCommitLatency:
+		a.batchSize = uint(float64(a.batchSize) * adaptiveShrinkFactor)
+	case latency < a.policy.TargetCommitLatency/2:
+		a.batchSize = uint(float64(a.batchSize)*adaptiveGrowFactor) + 1
+	}
+	a.batchSize = min(max(a.batchSize, a.policy.MinBatchSize), a.maxBatchSize)
+
+	elapsed := time.Since(a.lastObserved)
+	a.lastObserved = time.Now()
+
+	a.batchDuration = a.maxBatchDuration
+	if a.inbound > 0 && elapsed > 0 {
+		rate := float64(a.inbound) / elapsed.Seconds()
+		fill := time.Duration(float64(a.batchSize) / rate * float64(time.Second))
+		a.batchDuration = min(max(fill, a.policy.MinBatchDuration), a.maxBatchDuration)
+	}
+	a.inbound = 0
+
+	return a.batchSize, a.batchDuration
+}
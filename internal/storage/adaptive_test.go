@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveBatchingBatchSize(t *testing.T) {
+	policy := AdaptivePolicy{
+		MinBatchSize:        100,
+		MinBatchDuration:    time.Second,
+		TargetCommitLatency: 2 * time.Second,
+	}
+
+	for name, tc := range map[string]struct {
+		size    uint
+		latency time.Duration
+		want    uint
+	}{
+		"slow commit halves the batch":      {size: 1000, latency: 3 * time.Second, want: 500},
+		"fast commit grows the batch":       {size: 400, latency: 500 * time.Millisecond, want: 501},
+		"commit near the target keeps size": {size: 400, latency: 1500 * time.Millisecond, want: 400},
+		"batch isn't less than the minimum": {size: 150, latency: 3 * time.Second, want: 100},
+		"batch isn't more than the maximum": {size: 900, latency: 0, want: 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newAdaptiveBatching(policy, 1000, time.Minute)
+			a.batchSize = tc.size
+
+			size, _ := a.observe(tc.latency)
+			if size != tc.want {
+				t.Fatalf("batch size: got %d, want %d", size, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBatchingBatchDuration(t *testing.T) {
+	policy := AdaptivePolicy{
+		MinBatchSize:        100,
+		MinBatchDuration:    time.Second,
+		TargetCommitLatency: 2 * time.Second,
+	}
+
+	for name, tc := range map[string]struct {
+		inbound uint64
+		want    func(time.Duration) bool
+	}{
+		"no inflow flushes by the max duration": {
+			inbound: 0,
+			want:    func(d time.Duration) bool { return d == time.Minute },
+		},
+		"spike flushes by the min duration": {
+			inbound: 1_000_000,
+			want:    func(d time.Duration) bool { return d == time.Second },
+		},
+		"moderate inflow flushes when the batch is filled": {
+			// 1000 items per 10s fill the batch of 1000 items in about 10s
+			inbound: 1000,
+			want:    func(d time.Duration) bool { return d > 9*time.Second && d < 11*time.Second },
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newAdaptiveBatching(policy, 1000, time.Minute)
+			a.lastObserved = time.Now().Add(-10 * time.Second)
+			a.addInbound(int(tc.inbound))
+
+			_, duration := a.observe(time.Second)
+			if !tc.want(duration) {
+				t.Fatalf("unexpected batch duration: %s", duration)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBatchingRecoversAfterBackoff(t *testing.T) {
+	a := newAdaptiveBatching(AdaptivePolicy{
+		MinBatchSize:        10,
+		MinBatchDuration:    time.Second,
+		TargetCommitLatency: time.Second,
+	}, 1000, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		a.observe(2 * time.Second)
+	}
+	if size, _ := a.current(); size != 10 {
+		t.Fatalf("batch size after slow commits: %d", size)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.observe(0)
+	}
+	if size, _ := a.current(); size != 1000 {
+		t.Fatalf("batch size after fast commits: %d", size)
+	}
+}
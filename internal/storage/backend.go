@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Backend starts batches of inserts to the clickhouse
+type Backend interface {
+	Begin(ctx context.Context, query string) (Batch, error)
+}
+
+// Batch accumulates rows and sends them to the clickhouse on commit
+type Batch interface {
+	Append(values ...any) error
+	Commit() error
+	Abort() error
+}
+
+// SQLBackend inserts rows by prepared statement executed per row in the database/sql transaction
+type SQLBackend struct {
+	conn *sql.DB
+}
+
+func NewSQLBackend(conn *sql.DB) *SQLBackend {
+	return &SQLBackend{conn: conn}
+}
+
+func (b *SQLBackend) Begin(ctx context.Context, query string) (Batch, error) {
+	tx, err := b.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return nil, fmt.Errorf("prepare statement: %w", err)
+	}
+
+	return &sqlBatch{tx: tx, stmt: stmt}, nil
+}
+
+type sqlBatch struct {
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+func (b *sqlBatch) Append(values ...any) error {
+	_, err := b.stmt.Exec(values...)
+
+	return err
+}
+
+func (b *sqlBatch) Commit() error {
+	return b.tx.Commit()
+}
+
+func (b *sqlBatch) Abort() error {
+	return b.tx.Rollback()
+}
+
+// NativeBackend inserts rows by the native clickhouse batch: rows are appended to columns in memory
+// and sent in the columnar format on commit
+type NativeBackend struct {
+	conn driver.Conn
+}
+
+func NewNativeBackend(conn driver.Conn) *NativeBackend {
+	return &NativeBackend{conn: conn}
+}
+
+func (b *NativeBackend) Begin(ctx context.Context, query string) (Batch, error) {
+	batch, err := b.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("prepare batch: %w", err)
+	}
+
+	return &nativeBatch{batch: batch}, nil
+}
+
+type nativeBatch struct {
+	batch driver.Batch
+}
+
+func (b *nativeBatch) Append(values ...any) error {
+	return b.batch.Append(values...)
+}
+
+func (b *nativeBatch) Commit() error {
+	return b.batch.Send()
+}
+
+func (b *nativeBatch) Abort() error {
+	return b.batch.Abort()
+}
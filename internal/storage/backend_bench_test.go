@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// benchDSNEnv is the dsn of the clickhouse the backends are benchmarked against,
+// e.g. clickhouse://default:@127.0.0.1:9000/default
+const benchDSNEnv = "CLICKHOUSE_BENCH_DSN"
+
+const benchTable = "storage_backend_bench"
+
+func BenchmarkSQLBackend(b *testing.B) {
+	opts := benchOptions(b)
+
+	conn := clickhouse.OpenDB(opts)
+	b.Cleanup(func() { _ = conn.Close() })
+
+	benchmarkBackend(b, NewSQLBackend(conn), func(ctx context.Context, query string) error {
+		_, err := conn.ExecContext(ctx, query)
+
+		return err
+	})
+}
+
+func BenchmarkNativeBackend(b *testing.B) {
+	opts := benchOptions(b)
+
+	conn, err := clickhouse.Open(opts)
+	if err != nil {
+		b.Fatalf("open native connection: %v", err)
+	}
+	b.Cleanup(func() { _ = conn.Close() })
+
+	benchmarkBackend(b, NewNativeBackend(conn), func(ctx context.Context, query string) error {
+		return conn.Exec(ctx, query)
+	})
+}
+
+func benchOptions(b *testing.B) *clickhouse.Options {
+	b.Helper()
+
+	dsn := os.Getenv(benchDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", benchDSNEnv)
+	}
+
+	opts, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		b.Fatalf("parse dsn: %v", err)
+	}
+
+	return opts
+}
+
+// benchmarkBackend inserts batches of vote like rows and reports the insert rate
+func benchmarkBackend(b *testing.B, backend Backend, exec func(ctx context.Context, query string) error) {
+	ctx := context.Background()
+
+	if err := exec(ctx, fmt.Sprintf(`create table if not exists %s (
+		dao_id UUID,
+		proposal_id String,
+		voter String,
+		vp Float64,
+		created_at DateTime
+	) engine = MergeTree order by (dao_id, proposal_id, voter)`, benchTable)); err != nil {
+		b.Fatalf("create table: %v", err)
+	}
+	b.Cleanup(func() {
+		_ = exec(ctx, fmt.Sprintf("drop table if exists %s", benchTable))
+	})
+
+	query := fmt.Sprintf("insert into %s (dao_id, proposal_id, voter, vp, created_at) values (?, ?, ?, ?, ?)", benchTable)
+	createdAt := time.Now().UTC().Truncate(time.Second)
+
+	for _, size := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("batch_%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				batch, err := backend.Begin(ctx, query)
+				if err != nil {
+					b.Fatalf("begin: %v", err)
+				}
+
+				for j := 0; j < size; j++ {
+					err = batch.Append(
+						"5f4d1b1c-7a52-4c8f-9c6e-0a1b2c3d4e5f",
+						fmt.Sprintf("proposal-%d", j%100),
+						fmt.Sprintf("0x%040d", j),
+						float64(j),
+						createdAt,
+					)
+					if err != nil {
+						_ = batch.Abort()
+						b.Fatalf("append: %v", err)
+					}
+				}
+
+				if err = batch.Commit(); err != nil {
+					b.Fatalf("commit: %v", err)
+				}
+			}
+
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	deadLetterFileExt = ".jsonl"
+	// deadLetterReplayExt is appended to the path of the file taken by the replay
+	deadLetterReplayExt = ".replay"
+)
+
+// DeadLetter is a batch of items which wasn't committed to the clickhouse after all retries.
+// Items are stored as JSON to be able to replay them by the worker of the same source.
+type DeadLetter struct {
+	Source   string            `json:"source"`
+	FailedAt time.Time         `json:"failed_at"`
+	Reason   string            `json:"reason"`
+	Items    []json.RawMessage `json:"items"`
+}
+
+type DeadLetterSink interface {
+	Write(ctx context.Context, dl DeadLetter) error
+}
+
+type Publisher interface {
+	PublishJSON(ctx context.Context, subject string, obj any) error
+}
+
+// FileSink appends dead letters to the <dir>/<source>.jsonl file, one batch per line. Appends hold the exclusive
+// file lock, so the file may be rotated by TakeDeadLetters of another process while the sink is writing.
+type FileSink struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dead letter dir: %w", err)
+	}
+
+	return &FileSink{dir: dir}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return AppendDeadLetters(s.Path(dl.Source), []DeadLetter{dl})
+}
+
+func (s *FileSink) Path(source string) string {
+	return filepath.Join(s.dir, source+deadLetterFileExt)
+}
+
+const (
+	// defaultMaxPayload is the max payload of the nats server by default, it's used until the connection is established
+	defaultMaxPayload = 1 << 20
+	// natsHeadersReserve is left for headers of the message
+	natsHeadersReserve = 4 << 10
+)
+
+// NatsSink publishes dead letters to the <prefix>.<source> subject. Letters exceeding the max payload are split
+// by items into several letters, the failed part fails the whole letter and earlier parts are published again
+// on the next attempt.
+type NatsSink struct {
+	publisher  Publisher
+	prefix     string
+	maxPayload func() int64
+}
+
+// NewNatsSink creates the sink, maxPayload returns the max payload of the connection or 0 if it isn't known yet
+func NewNatsSink(p Publisher, prefix string, maxPayload func() int64) *NatsSink {
+	return &NatsSink{
+		publisher:  p,
+		prefix:     prefix,
+		maxPayload: maxPayload,
+	}
+}
+
+func (s *NatsSink) Write(ctx context.Context, dl DeadLetter) error {
+	limit := int64(defaultMaxPayload)
+	if mp := s.maxPayload(); mp > 0 {
+		limit = mp
+	}
+
+	parts, err := splitDeadLetter(dl, int(limit)-natsHeadersReserve)
+	if err != nil {
+		return err
+	}
+
+	for i, part := range parts {
+		if err = s.publisher.PublishJSON(ctx, s.Subject(dl.Source), part); err != nil {
+			return fmt.Errorf("publish dead letter part %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+
+	return nil
+}
+
+func (s *NatsSink) Subject(source string) string {
+	return fmt.Sprintf("%s.%s", s.prefix, source)
+}
+
+// ReadDeadLetters reads dead letters written by FileSink
+func ReadDeadLetters(r io.Reader) ([]DeadLetter, error) {
+	var res []DeadLetter
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 512*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			return nil, fmt.Errorf("unmarshal dead letter: %w", err)
+		}
+
+		res = append(res, dl)
+	}
+
+	return res, scanner.Err()
+}
+
+// WriteDeadLetters writes dead letters in the format of FileSink
+func WriteDeadLetters(w io.Writer, letters []DeadLetter) error {
+	bw := bufio.NewWriter(w)
+	for _, dl := range letters {
+		data, err := json.Marshal(dl)
+		if err != nil {
+			return fmt.Errorf("marshal dead letter: %w", err)
+		}
+
+		if _, err = bw.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("write dead letter: %w", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// splitDeadLetter splits items of the dead letter into letters which are marshalled within the limit
+func splitDeadLetter(dl DeadLetter, limit int) ([]DeadLetter, error) {
+	empty := dl
+	empty.Items = []json.RawMessage{}
+	data, err := json.Marshal(empty)
+	if err != nil {
+		return nil, fmt.Errorf("marshal dead letter: %w", err)
+	}
+	overhead := len(data)
+
+	var res []DeadLetter
+	part := empty
+	part.Items = nil
+	size := overhead
+	for _, item := range dl.Items {
+		// the item is followed by the comma
+		itemSize := len(item) + 1
+		if overhead+itemSize > limit {
+			return nil, fmt.Errorf("dead letter item of %d bytes exceeds the max payload %d", len(item), limit)
+		}
+
+		if size+itemSize > limit {
+			res = append(res, part)
+			part.Items = nil
+			size = overhead
+		}
+		part.Items = append(part.Items, item)
+		size += itemSize
+	}
+
+	return append(res, part), nil
+}
+
+// AppendDeadLetters appends dead letters to the file in the format of FileSink under the exclusive file lock.
+// The file is opened again if it was rotated while the lock was awaited.
+func AppendDeadLetters(path string, letters []DeadLetter) error {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("open dead letter file: %w", err)
+		}
+
+		rotated, err := lockFile(f, path)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if rotated {
+			f.Close()
+			continue
+		}
+
+		err = WriteDeadLetters(f, letters)
+		if err == nil {
+			err = f.Sync()
+		}
+		// closing the file releases the lock
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("write dead letters: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// TakeDeadLetters moves the dead letter file away from the sink and returns the path of the taken file. Writes
+// which started before are completed before it returns, later ones go to the new file. The file left by
+// the interrupted replay is taken again instead of the current one.
+func TakeDeadLetters(path string) (string, error) {
+	taken := path + deadLetterReplayExt
+	if _, err := os.Stat(taken); err == nil {
+		return taken, nil
+	}
+
+	if err := os.Rename(path, taken); err != nil {
+		return "", fmt.Errorf("take dead letters: %w", err)
+	}
+
+	f, err := os.Open(taken)
+	if err != nil {
+		return "", fmt.Errorf("open dead letters: %w", err)
+	}
+	defer f.Close()
+
+	// waits for the sink which opened the file before the rename
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return "", fmt.Errorf("lock dead letters: %w", err)
+	}
+
+	return taken, nil
+}
+
+// lockFile takes the exclusive lock of the opened file and reports whether the path refers to another file already
+func lockFile(f *os.File, path string) (bool, error) {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return false, fmt.Errorf("lock dead letter file: %w", err)
+	}
+
+	opened, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat dead letter file: %w", err)
+	}
+
+	current, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat dead letter file: %w", err)
+	}
+
+	return !os.SameFile(opened, current), nil
+}
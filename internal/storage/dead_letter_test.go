@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func readLetters(t *testing.T, path string) []DeadLetter {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	letters, err := ReadDeadLetters(f)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	return letters
+}
+
+func TestTakeDeadLetters(t *testing.T) {
+	sink, err := NewFileSink(t.TempDir())
+	if err != nil {
+		t.Fatalf("sink: %v", err)
+	}
+	path := sink.Path("votes")
+
+	if err = sink.Write(context.Background(), DeadLetter{Source: "votes", Reason: "first"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	taken, err := TakeDeadLetters(path)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+
+	// letters written during the replay go to the new file
+	if err = sink.Write(context.Background(), DeadLetter{Source: "votes", Reason: "second"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := readLetters(t, taken); len(got) != 1 || got[0].Reason != "first" {
+		t.Fatalf("taken letters: %+v", got)
+	}
+	if got := readLetters(t, path); len(got) != 1 || got[0].Reason != "second" {
+		t.Fatalf("new letters: %+v", got)
+	}
+
+	// the file of the interrupted replay is taken again
+	again, err := TakeDeadLetters(path)
+	if err != nil {
+		t.Fatalf("take again: %v", err)
+	}
+	if got := readLetters(t, again); len(got) != 1 || got[0].Reason != "first" {
+		t.Fatalf("letters taken again: %+v", got)
+	}
+}
+
+func TestLockFileDetectsRotation(t *testing.T) {
+	sink, err := NewFileSink(t.TempDir())
+	if err != nil {
+		t.Fatalf("sink: %v", err)
+	}
+	path := sink.Path("votes")
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	// the file opened by the sink is moved away before the lock is taken
+	if err = os.Rename(path, path+".old"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	rotated, err := lockFile(f, path)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if !rotated {
+		t.Fatal("rotated file isn't detected")
+	}
+}
+
+type fakePublisher struct {
+	payloads [][]byte
+}
+
+func (p *fakePublisher) PublishJSON(_ context.Context, _ string, obj any) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	p.payloads = append(p.payloads, data)
+
+	return nil
+}
+
+func TestNatsSinkSplitsLetterByMaxPayload(t *testing.T) {
+	dl := DeadLetter{Source: "votes", Reason: "commit failed"}
+	for i := 0; i < 100; i++ {
+		dl.Items = append(dl.Items, json.RawMessage(fmt.Sprintf(`{"value":"%0100d"}`, i)))
+	}
+
+	const maxPayload = natsHeadersReserve + 2000
+	publisher := &fakePublisher{}
+	sink := NewNatsSink(publisher, "dead_letters", func() int64 { return maxPayload })
+	if err := sink.Write(context.Background(), dl); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if len(publisher.payloads) < 2 {
+		t.Fatalf("letter isn't split: %d parts", len(publisher.payloads))
+	}
+
+	var items int
+	for _, payload := range publisher.payloads {
+		if len(payload) > maxPayload-natsHeadersReserve {
+			t.Fatalf("part of %d bytes exceeds the max payload", len(payload))
+		}
+
+		var part DeadLetter
+		if err := json.Unmarshal(payload, &part); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if part.Source != dl.Source || part.Reason != dl.Reason {
+			t.Fatalf("part: %+v", part)
+		}
+		items += len(part.Items)
+	}
+	if items != len(dl.Items) {
+		t.Fatalf("items: %d", items)
+	}
+}
+
+func TestNatsSinkFailsForTooLargeItem(t *testing.T) {
+	dl := DeadLetter{Source: "votes", Items: []json.RawMessage{json.RawMessage(fmt.Sprintf(`"%02000d"`, 0))}}
+
+	sink := NewNatsSink(&fakePublisher{}, "dead_letters", func() int64 { return natsHeadersReserve + 1000 })
+	if err := sink.Write(context.Background(), dl); err == nil {
+		t.Fatal("too large item is published")
+	}
+}
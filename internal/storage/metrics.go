@@ -20,6 +20,56 @@ var (
 		[]string{"source"},
 	)
 
+	retriesCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "commit_retries",
+			Help:      "Count of batch commit retries to clickhouse",
+		},
+		[]string{"source"},
+	)
+
+	deadLettersCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "dead_letter_records",
+			Help:      "Count of records which weren't committed to clickhouse after all retries",
+		},
+		[]string{"source"},
+	)
+
+	degradedGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "degraded",
+			Help:      "Whether the storage worker is unable to start transaction in clickhouse",
+		},
+		[]string{"source"},
+	)
+
+	batchSizeGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "batch_size_limit",
+			Help:      "Effective max size of the batch",
+		},
+		[]string{"source"},
+	)
+
+	batchDurationGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "batch_duration_limit_seconds",
+			Help:      "Effective flush interval of the batch",
+		},
+		[]string{"source"},
+	)
+
 	histCommitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: metrics.Namespace,
 		Subsystem: subsystem,
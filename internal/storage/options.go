@@ -0,0 +1,97 @@
+package storage
+
+import "time"
+
+type Option func(*options)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type options struct {
+	retry             RetryPolicy
+	deadLetters       DeadLetterSink
+	walDir            string
+	walSyncInterval   time.Duration
+	channelCapacity   uint
+	insertConcurrency uint
+	adaptive          *AdaptivePolicy
+}
+
+func defaultOptions() options {
+	return options{
+		retry: RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+		},
+		insertConcurrency: 1,
+	}
+}
+
+// WithRetryPolicy sets how many times and how often the failed batch is re-inserted to the clickhouse
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithDeadLetterSink sets the sink for batches which weren't committed after all retries
+func WithDeadLetterSink(s DeadLetterSink) Option {
+	return func(o *options) {
+		o.deadLetters = s
+	}
+}
+
+// WithWAL enables the write-ahead log in the dir: stored items are written to the disk before the batching
+// and replayed on the next start if the process stops before their commit. Writes are synced to the disk
+// once per sync interval, zero interval syncs every write.
+func WithWAL(dir string, syncInterval time.Duration) Option {
+	return func(o *options) {
+		o.walDir = dir
+		o.walSyncInterval = syncInterval
+	}
+}
+
+// WithChannelCapacity sets the size of the in-memory queue, by default it's twice the max batch size
+func WithChannelCapacity(capacity uint) Option {
+	return func(o *options) {
+		o.channelCapacity = capacity
+	}
+}
+
+// WithInsertConcurrency limits the number of batches which are committed to the clickhouse at the same time
+func WithInsertConcurrency(concurrency uint) Option {
+	return func(o *options) {
+		o.insertConcurrency = concurrency
+	}
+}
+
+// WithAdaptiveBatching enables tuning of the batch size and flush interval between the policy minimums
+// and the worker maximums by the observed commit latency and inbound rate
+func WithAdaptiveBatching(p AdaptivePolicy) Option {
+	return func(o *options) {
+		o.adaptive = &p
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, p.MaxBackoff)
+}
+
+// maxDelay returns the sum of backoffs of all attempts
+func (p RetryPolicy) maxDelay() time.Duration {
+	var delay time.Duration
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		delay += p.backoff(attempt)
+	}
+
+	return delay
+}
@@ -0,0 +1,35 @@
+package storage
+
+import "sync"
+
+// ticket tracks items of one StoreWithAck call which can be spread across several batches
+type ticket struct {
+	mu        sync.Mutex
+	remaining int
+	err       error
+	ack       func(error)
+}
+
+func newTicket(count int, ack func(error)) *ticket {
+	return &ticket{
+		remaining: count,
+		ack:       ack,
+	}
+}
+
+// done marks count items as finished and calls ack when all items of the ticket are finished.
+// The first error is passed to ack.
+func (t *ticket) done(count int, err error) {
+	t.mu.Lock()
+	t.remaining -= count
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	finished := t.remaining <= 0
+	err = t.err
+	t.mu.Unlock()
+
+	if finished {
+		t.ack(err)
+	}
+}
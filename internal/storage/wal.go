@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const walSegmentExt = ".wal"
+
+// wal is a write-ahead log of stored items split into segments. The segment is rotated on each batch commit
+// and removed once all its records are committed or written to the dead letter sink.
+// Appended records are synced to the disk by the group: on the sync interval, on rotation and on close.
+// Items are acked only after the commit, so records lost by the crash within the interval are redelivered.
+type wal struct {
+	dir          string
+	syncInterval time.Duration
+
+	mu          sync.Mutex
+	current     *os.File
+	currentID   uint64
+	currentSize int
+	dirty       bool
+	outstanding map[uint64]int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type walRecord struct {
+	segment uint64
+	data    []byte
+}
+
+// openWAL opens the log in the dir and returns records left from the previous run.
+// Zero sync interval syncs the segment on every append.
+func openWAL(dir string, syncInterval time.Duration) (*wal, []walRecord, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("create wal dir: %w", err)
+	}
+
+	ids, err := listSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &wal{
+		dir:          dir,
+		syncInterval: syncInterval,
+		outstanding:  make(map[uint64]int),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+
+	var records []walRecord
+	for _, id := range ids {
+		segmentRecords, err := w.readSegment(id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(segmentRecords) == 0 {
+			if err = os.Remove(w.path(id)); err != nil {
+				return nil, nil, fmt.Errorf("remove empty wal segment: %w", err)
+			}
+
+			continue
+		}
+
+		w.outstanding[id] = len(segmentRecords)
+		records = append(records, segmentRecords...)
+	}
+
+	next := uint64(1)
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	if err = w.openSegment(next); err != nil {
+		return nil, nil, err
+	}
+
+	go w.syncLoop()
+
+	return w, records, nil
+}
+
+func (w *wal) syncLoop() {
+	defer close(w.stopped)
+
+	if w.syncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(w.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			err := w.syncUnsafe()
+			w.mu.Unlock()
+
+			if err != nil {
+				log.Error().Err(err).Str("dir", w.dir).Msg("unable to sync wal segment")
+			}
+		}
+	}
+}
+
+// append writes records to the current segment, it's synced to the disk by the sync loop
+func (w *wal) append(records [][]byte) (uint64, error) {
+	var buf []byte
+	for _, r := range records {
+		buf = append(buf, r...)
+		buf = append(buf, '\n')
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.current.Write(buf); err != nil {
+		return 0, fmt.Errorf("write wal: %w", err)
+	}
+	w.dirty = true
+
+	if w.syncInterval <= 0 {
+		if err := w.syncUnsafe(); err != nil {
+			return 0, err
+		}
+	}
+
+	w.outstanding[w.currentID] += len(records)
+	w.currentSize += len(buf)
+
+	return w.currentID, nil
+}
+
+// rotate starts the new segment, the previous one is removed after releasing all its records
+func (w *wal) rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.currentSize == 0 {
+		return nil
+	}
+
+	prevID := w.currentID
+	if err := w.syncUnsafe(); err != nil {
+		return err
+	}
+	if err := w.current.Close(); err != nil {
+		return fmt.Errorf("close wal segment: %w", err)
+	}
+
+	if w.outstanding[prevID] <= 0 {
+		delete(w.outstanding, prevID)
+		if err := os.Remove(w.path(prevID)); err != nil {
+			return fmt.Errorf("remove wal segment: %w", err)
+		}
+	}
+
+	return w.openSegment(prevID + 1)
+}
+
+// release marks records of the segments as persisted and removes finished segments
+func (w *wal) release(segments map[uint64]int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, count := range segments {
+		w.outstanding[id] -= count
+		if w.outstanding[id] > 0 || id == w.currentID {
+			continue
+		}
+
+		delete(w.outstanding, id)
+		if err := os.Remove(w.path(id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove wal segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (w *wal) close() error {
+	close(w.stop)
+	<-w.stopped
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.syncUnsafe(); err != nil {
+		_ = w.current.Close()
+
+		return err
+	}
+
+	return w.current.Close()
+}
+
+func (w *wal) syncUnsafe() error {
+	if !w.dirty {
+		return nil
+	}
+
+	if err := w.current.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.dirty = false
+
+	return nil
+}
+
+func (w *wal) openSegment(id uint64) error {
+	f, err := os.OpenFile(w.path(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open wal segment: %w", err)
+	}
+
+	w.current = f
+	w.currentID = id
+	w.currentSize = 0
+	w.dirty = false
+
+	return nil
+}
+
+func (w *wal) readSegment(id uint64) ([]walRecord, error) {
+	f, err := os.Open(w.path(id))
+	if err != nil {
+		return nil, fmt.Errorf("open wal segment: %w", err)
+	}
+	defer f.Close()
+
+	var res []walRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		res = append(res, walRecord{
+			segment: id,
+			data:    append([]byte(nil), scanner.Bytes()...),
+		})
+	}
+
+	return res, scanner.Err()
+}
+
+func (w *wal) path(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, walSegmentExt))
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read wal dir: %w", err)
+	}
+
+	ids := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids, nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func walRecordsData(records []walRecord) []string {
+	res := make([]string, len(records))
+	for i, r := range records {
+		res[i] = string(r.data)
+	}
+
+	return res
+}
+
+func segmentsCount(t *testing.T, dir string) int {
+	t.Helper()
+
+	ids, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("list segments: %v", err)
+	}
+
+	return len(ids)
+}
+
+func TestWALRoundTrip(t *testing.T) {
+	for name, syncInterval := range map[string]time.Duration{
+		"sync on every append": 0,
+		"group sync":           time.Hour,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			w, records, err := openWAL(dir, syncInterval)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			if len(records) != 0 {
+				t.Fatalf("records of the empty wal: %v", walRecordsData(records))
+			}
+
+			first, err := w.append([][]byte{[]byte(`{"value":"a"}`), []byte(`{"value":"b"}`)})
+			if err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			if err = w.rotate(); err != nil {
+				t.Fatalf("rotate: %v", err)
+			}
+			second, err := w.append([][]byte{[]byte(`{"value":"c"}`)})
+			if err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			if first == second {
+				t.Fatalf("segment wasn't rotated: %d", first)
+			}
+			if err = w.close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			w, records, err = openWAL(dir, syncInterval)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer w.close()
+
+			got := walRecordsData(records)
+			want := []string{`{"value":"a"}`, `{"value":"b"}`, `{"value":"c"}`}
+			if len(got) != len(want) {
+				t.Fatalf("records: %v", got)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("records: %v", got)
+				}
+			}
+			if records[0].segment != first || records[2].segment != second {
+				t.Fatalf("segments of records: %d, %d", records[0].segment, records[2].segment)
+			}
+		})
+	}
+}
+
+func TestWALReleaseRemovesSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, err := openWAL(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer w.close()
+
+	segment, err := w.append([][]byte{[]byte("a"), []byte("b")})
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err = w.rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	if err = w.release(map[uint64]int{segment: 1}); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err = os.Stat(w.path(segment)); err != nil {
+		t.Fatalf("segment with outstanding records was removed: %v", err)
+	}
+
+	if err = w.release(map[uint64]int{segment: 1}); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err = os.Stat(w.path(segment)); !os.IsNotExist(err) {
+		t.Fatalf("released segment wasn't removed: %v", err)
+	}
+	if count := segmentsCount(t, dir); count != 1 {
+		t.Fatalf("segments: %d", count)
+	}
+}
+
+func TestWALSyncLoop(t *testing.T) {
+	w, _, err := openWAL(t.TempDir(), time.Millisecond)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer w.close()
+
+	if _, err = w.append([][]byte{[]byte("a")}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		dirty := w.dirty
+		w.mu.Unlock()
+
+		if !dirty {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("appended records weren't synced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -2,9 +2,12 @@ package storage
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,8 +20,12 @@ const (
 	Failed
 )
 
+const deadLetterWriteTimeout = 30 * time.Second
+
 var (
 	ErrWorkerIsNotActive = errors.New("storage worker is not active")
+
+	errNoTransaction = errors.New("transaction is not started")
 )
 
 type GroupState uint8
@@ -31,22 +38,41 @@ type Adapter[T any] interface {
 	GetCategoryID(T) uint32
 }
 
+type entry[T any] struct {
+	item    T
+	ticket  *ticket
+	segment uint64
+}
+
 type ClickhouseWorker[T any] struct {
 	source           string
-	conn             *sql.DB
+	backend          Backend
 	adapter          Adapter[T]
 	maxBatchDuration time.Duration
 	maxBatchSize     uint
-
-	txLock    sync.RWMutex
-	tx        *sql.Tx
-	txStmt    *sql.Stmt
-	commitsWG sync.WaitGroup
-
-	ch       chan T
+	opts             options
+
+	txLock       sync.Mutex
+	batch        Batch
+	batchItems   []T
+	batchTickets map[*ticket]int
+	batchSegment map[uint64]int
+	batchErr     error
+	commitsWG    sync.WaitGroup
+	commitsSem   chan struct{}
+
+	wal         *wal
+	degraded    atomic.Bool
+	uncommitted atomic.Int64
+	ticker      *time.Ticker
+	intervals   chan time.Duration
+	adaptive    *adaptiveBatching
+
+	ch       chan entry[T]
 	chWg     sync.WaitGroup
 	chActive bool
 	chLock   sync.RWMutex
+	ready    chan struct{}
 
 	stateLock  sync.RWMutex
 	pending    map[uint32]uint
@@ -58,32 +84,74 @@ type ClickhouseWorker[T any] struct {
 	callbacks []Callback
 }
 
-func NewClickhouseWorker[T any](source string, conn *sql.DB, adapter Adapter[T], maxBatchSize uint, maxBatchDuration time.Duration) *ClickhouseWorker[T] {
-	return &ClickhouseWorker[T]{
+func NewClickhouseWorker[T any](source string, backend Backend, adapter Adapter[T], maxBatchSize uint, maxBatchDuration time.Duration, opts ...Option) *ClickhouseWorker[T] {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.channelCapacity == 0 {
+		o.channelCapacity = maxBatchSize + maxBatchSize
+	}
+	if o.insertConcurrency == 0 {
+		o.insertConcurrency = 1
+	}
+
+	w := &ClickhouseWorker[T]{
 		source:           source,
-		conn:             conn,
+		backend:          backend,
 		adapter:          adapter,
 		maxBatchSize:     maxBatchSize,
 		maxBatchDuration: maxBatchDuration,
+		opts:             o,
+
+		batchTickets: make(map[*ticket]int),
+		batchSegment: make(map[uint64]int),
+		commitsSem:   make(chan struct{}, o.insertConcurrency),
+		intervals:    make(chan time.Duration, 1),
+		ready:        make(chan struct{}),
 
 		pending:    make(map[uint32]uint, maxBatchSize+maxBatchSize),
 		executed:   make(map[uint32]uint, maxBatchSize),
 		committing: make(map[uint32]uint, maxBatchSize),
 	}
+
+	if o.adaptive != nil {
+		w.adaptive = newAdaptiveBatching(*o.adaptive, maxBatchSize, maxBatchDuration)
+	}
+
+	return w
 }
 
 func (w *ClickhouseWorker[T]) Start(ctx context.Context) error {
-	ticker := time.NewTicker(w.maxBatchDuration)
+	var walRecords []walRecord
+	if w.opts.walDir != "" {
+		var err error
+		w.wal, walRecords, err = openWAL(filepath.Join(w.opts.walDir, w.source), w.opts.walSyncInterval)
+		if err != nil {
+			return fmt.Errorf("open wal: %w", err)
+		}
+	}
+
+	w.ticker = time.NewTicker(w.maxBatchDuration)
+	defer w.ticker.Stop()
+	w.observeBatchLimits(w.maxBatchSize, w.maxBatchDuration)
 
 	w.chLock.Lock()
 	w.chActive = true
-	w.ch = make(chan T, w.maxBatchSize+w.maxBatchSize)
+	w.ch = make(chan entry[T], w.opts.channelCapacity)
 	w.chLock.Unlock()
 
-	w.createNewTxUnsafe()
+	w.txLock.Lock()
+	w.createNewTxUnsafe(ctx)
+	w.txLock.Unlock()
 
 	// Run goroutine for reading items from the channel
-	go w.processItems()
+	go w.processItems(ctx)
+	close(w.ready)
+
+	if err := w.replayWAL(walRecords); err != nil {
+		return err
+	}
 
 	for {
 		select {
@@ -96,77 +164,163 @@ func (w *ClickhouseWorker[T]) Start(ctx context.Context) error {
 			// waiting for reading all events from the channel
 			w.chWg.Wait()
 
-			w.commit()
+			w.commit(ctx)
 
 			w.commitsWG.Wait()
 
+			if w.wal != nil {
+				if err := w.wal.close(); err != nil {
+					log.Error().Err(err).Str("source", w.source).Msg("unable to close wal")
+				}
+			}
+
 			err := ctx.Err()
 			if errors.Is(err, context.Canceled) {
 				return nil
 			}
 
 			return err
-		case <-ticker.C:
-			w.commitAndCreateNewTx()
+		case <-w.ticker.C:
+			w.commitAndCreateNewTx(ctx)
+		case interval := <-w.intervals:
+			w.ticker.Reset(interval)
 		}
 	}
 }
 
+// Uncommitted returns the number of stored items which are neither committed nor handled as failed yet
+func (w *ClickhouseWorker[T]) Uncommitted() int64 {
+	return w.uncommitted.Load()
+}
+
+// Ready is closed once the worker accepts items
+func (w *ClickhouseWorker[T]) Ready() <-chan struct{} {
+	return w.ready
+}
+
 func (w *ClickhouseWorker[T]) RegisterCallback(cb Callback) {
 	w.callbacks = append(w.callbacks, cb)
 }
 
-func (w *ClickhouseWorker[T]) commit() {
+func (w *ClickhouseWorker[T]) commit(ctx context.Context) {
 	w.txLock.Lock()
 	defer w.txLock.Unlock()
 
-	w.commitUnsafe()
+	w.commitUnsafe(ctx)
 }
 
-func (w *ClickhouseWorker[T]) commitAndCreateNewTx() {
+func (w *ClickhouseWorker[T]) commitAndCreateNewTx(ctx context.Context) {
 	w.txLock.Lock()
 	defer w.txLock.Unlock()
 
-	w.commitUnsafe()
-	w.createNewTxUnsafe()
+	w.commitUnsafe(ctx)
+	w.createNewTxUnsafe(ctx)
 }
 
-func (w *ClickhouseWorker[T]) commitUnsafe() {
-	w.commitsWG.Add(1)
-	go func(tx *sql.Tx, count uint) {
-		defer observe(histCommitDuration, w.source, time.Now())
+// IsDegraded returns true while the worker is unable to start the transaction in the clickhouse
+func (w *ClickhouseWorker[T]) IsDegraded() bool {
+	return w.degraded.Load()
+}
 
-		w.stateLock.Lock()
-		groups := make(map[uint32]GroupState, len(w.executed))
-		for group := range w.executed {
-			status := Committed
-			if w.pending[group] > 0 {
-				status = Pending
-			}
+func (w *ClickhouseWorker[T]) setDegraded(degraded bool) {
+	w.degraded.Store(degraded)
+
+	var value float64
+	if degraded {
+		value = 1
+	}
+	degradedGauge.WithLabelValues(w.source).Set(value)
+}
+
+// commitUnsafe commits the batch in the background. Retries stop once the context is done, so the batch
+// goes to the dead letter sink without waiting for the backoff on shutdown.
+func (w *ClickhouseWorker[T]) commitUnsafe(ctx context.Context) {
+	// blocks while the insert concurrency limit is reached, so the next batch isn't started
+	w.commitsSem <- struct{}{}
+	w.commitsWG.Add(1)
 
-			groups[group] = status
+	// groups of the batch are taken under the tx lock, so items appended after this point belong to the next batch
+	w.stateLock.Lock()
+	groups := make(map[uint32]GroupState, len(w.executed))
+	for group := range w.executed {
+		status := Committed
+		if w.pending[group] > 0 {
+			status = Pending
 		}
-		w.executed = make(map[uint32]uint, w.maxBatchSize)
-		w.stateLock.Unlock()
+
+		groups[group] = status
+	}
+	w.executed = make(map[uint32]uint, w.maxBatchSize)
+	w.stateLock.Unlock()
+
+	go func(batch Batch, items []T, tickets map[*ticket]int, segments map[uint64]int, execErr error, groups map[uint32]GroupState) {
+		start := time.Now()
+		defer observe(histCommitDuration, w.source, start)
 
 		log.Info().
 			Str("source", w.source).
-			Uint("count_records", count).
+			Int("count_records", len(items)).
 			Msg("commit batch to the clickhouse")
 
-		if err := tx.Commit(); err != nil {
+		err := execErr
+		var latency time.Duration
+		switch {
+		case batch == nil && len(items) == 0:
+		case batch == nil:
+			err = errNoTransaction
+		case err == nil:
+			commitStart := time.Now()
+			err = batch.Commit()
+			latency = time.Since(commitStart)
+		default:
+			_ = batch.Abort()
+		}
+
+		if err != nil {
 			log.Error().
 				Err(err).
 				Str("source", w.source).
-				Uint("count_records", count).
+				Int("count_records", len(items)).
 				Msg("unable to commit transaction to the clickhouse")
 
+			latency, err = w.retryUnsafe(ctx, items)
+		}
+
+		// the latency of the successful attempt only, the backoff between retries says nothing about the batch size
+		if err == nil && len(items) > 0 {
+			w.adapt(latency)
+		}
+
+		persisted := err == nil
+		if err != nil {
+			persisted = w.deadLetter(items, err)
+
 			failedGroups := make(map[uint32]GroupState, len(groups))
 			for blockNumKey := range groups {
 				failedGroups[blockNumKey] = Failed
 			}
 			groups = failedGroups
 		}
+
+		// items of the dead lettered batch are acked as well: they are persisted in the sink and
+		// the redelivery would store them twice
+		ackErr := err
+		if persisted {
+			ackErr = nil
+		}
+		for t, count := range tickets {
+			t.done(count, ackErr)
+		}
+		w.uncommitted.Add(-int64(len(items)))
+
+		// items which were neither committed nor written to the dead letter sink are left in the wal
+		// to be replayed on the next start
+		if w.wal != nil && persisted {
+			if err := w.wal.release(segments); err != nil {
+				log.Error().Err(err).Str("source", w.source).Msg("unable to release wal segments")
+			}
+		}
+		<-w.commitsSem
 		w.commitsWG.Done()
 
 		if len(groups) == 0 {
@@ -176,37 +330,201 @@ func (w *ClickhouseWorker[T]) commitUnsafe() {
 		for _, cb := range w.callbacks {
 			cb(groups)
 		}
-	}(w.tx, w.currentBatchSize)
+	}(w.batch, w.batchItems, w.batchTickets, w.batchSegment, w.batchErr, groups)
 
+	if w.wal != nil {
+		if err := w.wal.rotate(); err != nil {
+			log.Error().Err(err).Str("source", w.source).Msg("unable to rotate wal segment")
+		}
+	}
+
+	w.batchItems = make([]T, 0, w.maxBatchSize)
+	w.batchTickets = make(map[*ticket]int)
+	w.batchSegment = make(map[uint64]int)
+	w.batchErr = nil
 	w.currentBatchSize = 0
 }
 
-func (w *ClickhouseWorker[T]) createNewTxUnsafe() {
-	defer observe(histNewTxDuration, w.source, time.Now())
+// retryUnsafe re-inserts the whole batch in the new transaction with exponential backoff.
+// It returns the latency of the successful attempt.
+func (w *ClickhouseWorker[T]) retryUnsafe(ctx context.Context, items []T) (time.Duration, error) {
+	var err error
+	for attempt := 1; attempt <= w.opts.retry.MaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return 0, errors.Join(err, ctx.Err())
+		case <-time.After(w.opts.retry.backoff(attempt)):
+		}
+		retriesCounter.WithLabelValues(w.source).Inc()
+
+		start := time.Now()
+		if err = w.insert(items); err == nil {
+			log.Info().
+				Str("source", w.source).
+				Int("attempt", attempt).
+				Int("count_records", len(items)).
+				Msg("batch was committed to the clickhouse after retry")
+
+			return time.Since(start), nil
+		}
+
+		log.Warn().
+			Err(err).
+			Str("source", w.source).
+			Int("attempt", attempt).
+			Int("count_records", len(items)).
+			Msg("unable to retry batch commit to the clickhouse")
+	}
 
-	tx, err := w.conn.Begin()
+	return 0, err
+}
+
+func (w *ClickhouseWorker[T]) insert(items []T) error {
+	batch, err := w.backend.Begin(context.Background(), w.adapter.GetInsertQuery())
 	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err = batch.Append(w.adapter.Values(item)...); err != nil {
+			_ = batch.Abort()
+
+			return fmt.Errorf("append item: %w", err)
+		}
+	}
+
+	return batch.Commit()
+}
+
+// deadLetter writes the batch to the dead letter sink and returns true if it was written
+func (w *ClickhouseWorker[T]) deadLetter(items []T, reason error) bool {
+	deadLettersCounter.WithLabelValues(w.source).Add(float64(len(items)))
+
+	if w.opts.deadLetters == nil {
+		log.Error().
+			Err(reason).
+			Str("source", w.source).
+			Int("count_records", len(items)).
+			Msg("batch is not committed: dead letter sink is not configured")
+
+		return false
+	}
+
+	dl := DeadLetter{
+		Source:   w.source,
+		FailedAt: time.Now(),
+		Reason:   reason.Error(),
+		Items:    make([]json.RawMessage, 0, len(items)),
+	}
+	for _, item := range items {
+		// the batch without the item isn't dead lettered, so it's nacked to not lose the item
+		data, err := json.Marshal(item)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("source", w.source).
+				Int("count_records", len(items)).
+				Msg("unable to marshal dead letter item")
+
+			return false
+		}
+
+		dl.Items = append(dl.Items, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterWriteTimeout)
+	defer cancel()
+
+	if err := w.opts.deadLetters.Write(ctx, dl); err != nil {
 		log.Error().
 			Err(err).
-			Msg("unable to start new transaction in the clickhouse")
-		panic(err)
+			Str("source", w.source).
+			Int("count_records", len(items)).
+			Msg("unable to write batch to the dead letter sink")
+
+		return false
 	}
 
-	stmt, err := tx.Prepare(w.adapter.GetInsertQuery())
-	if err != nil {
+	log.Warn().
+		Err(reason).
+		Str("source", w.source).
+		Int("count_records", len(items)).
+		Msg("batch was written to the dead letter sink")
+
+	return true
+}
+
+// Replay stores items of the dead letter again, ack is called once all of them are committed
+func (w *ClickhouseWorker[T]) Replay(dl DeadLetter, ack func(error)) error {
+	if dl.Source != w.source {
+		return fmt.Errorf("dead letter source %s doesn't match worker source %s", dl.Source, w.source)
+	}
+
+	items := make([]T, 0, len(dl.Items))
+	for _, data := range dl.Items {
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return fmt.Errorf("unmarshal dead letter item: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	return w.StoreWithAck(ack, items...)
+}
+
+// createNewTxUnsafe starts the new transaction. While the clickhouse is unavailable the worker is degraded:
+// it retries with backoff holding the tx lock, so items aren't read from the channel and Store blocks
+// once the channel is full. If the context is done, the worker is left without transaction and the rest
+// of items goes through the retry path on the final commit.
+func (w *ClickhouseWorker[T]) createNewTxUnsafe(ctx context.Context) {
+	w.batch = nil
+
+	for attempt := 1; ; attempt++ {
+		err := w.beginUnsafe()
+		if err == nil {
+			if w.IsDegraded() {
+				log.Info().Str("source", w.source).Msg("connection to the clickhouse is restored")
+			}
+			w.setDegraded(false)
+
+			return
+		}
+
+		w.setDegraded(true)
 		log.Error().
 			Err(err).
+			Str("source", w.source).
+			Int("attempt", attempt).
 			Msg("unable to start new transaction in the clickhouse")
-		panic(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.opts.retry.backoff(attempt)):
+		}
 	}
+}
 
-	w.tx = tx
-	w.txStmt = stmt
+func (w *ClickhouseWorker[T]) beginUnsafe() error {
+	defer observe(histNewTxDuration, w.source, time.Now())
+
+	// the batch must outlive the worker context to be committed on shutdown
+	batch, err := w.backend.Begin(context.Background(), w.adapter.GetInsertQuery())
+	if err != nil {
+		return err
+	}
+
+	w.batch = batch
+
+	return nil
 }
 
-func (w *ClickhouseWorker[T]) processItems() {
-	for item := range w.ch {
-		w.txLock.RLock()
+func (w *ClickhouseWorker[T]) processItems(ctx context.Context) {
+	for e := range w.ch {
+		item := e.item
+		// the batch state is changed here, so the write lock is taken
+		w.txLock.Lock()
 
 		txesCounter.WithLabelValues(w.source).Inc()
 
@@ -219,18 +537,35 @@ func (w *ClickhouseWorker[T]) processItems() {
 		}
 		w.stateLock.Unlock()
 
-		_, err := w.txStmt.Exec(w.adapter.Values(item)...)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("unable to execute prepared statement")
+		// keep items of the batch to be able to retry it if the transaction fails
+		w.batchItems = append(w.batchItems, item)
+		if e.ticket != nil {
+			w.batchTickets[e.ticket]++
+		}
+		if e.segment != 0 {
+			w.batchSegment[e.segment]++
+		}
+		if w.batchErr == nil && w.batch == nil {
+			w.batchErr = errNoTransaction
+		}
+		if w.batchErr == nil {
+			err := w.batch.Append(w.adapter.Values(item)...)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("source", w.source).
+					Msg("unable to append item to the batch")
+
+				w.batchErr = err
+			}
 		}
 		w.currentBatchSize++
-		w.txLock.RUnlock()
+		full := w.currentBatchSize >= w.batchSizeLimit()
+		w.txLock.Unlock()
 		w.chWg.Done()
 
-		if w.currentBatchSize >= w.maxBatchSize {
-			w.commitAndCreateNewTx()
+		if full {
+			w.commitAndCreateNewTx(ctx)
 		}
 	}
 }
@@ -253,18 +588,192 @@ func (w *ClickhouseWorker[T]) Store(group uint32, items ...T) error {
 		return nil
 	}
 
+	segment, err := w.writeAhead(items)
+	if err != nil {
+		return err
+	}
+
 	w.stateLock.Lock()
 	w.pending[group] += uint(len(items))
 	w.stateLock.Unlock()
+	w.countInbound(len(items))
+
+	w.uncommitted.Add(int64(len(items)))
+	w.chWg.Add(len(items))
+	for _, item := range items {
+		w.ch <- entry[T]{item: item, segment: segment}
+	}
+
+	return nil
+}
+
+// StoreWithAck stores items and calls ack once the batches containing them are committed to the clickhouse
+// or written to the dead letter sink (nil error), or failed after all retries. Items may belong to different groups.
+func (w *ClickhouseWorker[T]) StoreWithAck(ack func(error), items ...T) error {
+	w.chLock.RLock()
+	defer w.chLock.RUnlock()
+
+	if !w.chActive {
+		return ErrWorkerIsNotActive
+	}
+
+	if len(items) == 0 {
+		ack(nil)
+
+		return nil
+	}
+
+	segment, err := w.writeAhead(items)
+	if err != nil {
+		return err
+	}
+
+	w.stateLock.Lock()
+	for _, item := range items {
+		w.pending[w.adapter.GetCategoryID(item)]++
+	}
+	w.stateLock.Unlock()
+	w.countInbound(len(items))
 
+	t := newTicket(len(items), ack)
+	w.uncommitted.Add(int64(len(items)))
 	w.chWg.Add(len(items))
 	for _, item := range items {
-		w.ch <- item
+		w.ch <- entry[T]{item: item, ticket: t, segment: segment}
 	}
 
 	return nil
 }
 
+// writeAhead appends items to the wal and returns the segment they were written to
+func (w *ClickhouseWorker[T]) writeAhead(items []T) (uint64, error) {
+	if w.wal == nil {
+		return 0, nil
+	}
+
+	records := make([][]byte, len(items))
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return 0, fmt.Errorf("marshal wal record: %w", err)
+		}
+
+		records[i] = data
+	}
+
+	return w.wal.append(records)
+}
+
+// replayWAL stores items left in the wal from the previous run to the current transaction
+func (w *ClickhouseWorker[T]) replayWAL(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	log.Info().
+		Str("source", w.source).
+		Int("count_records", len(records)).
+		Msg("replay items from the wal")
+
+	for _, r := range records {
+		var item T
+		if err := json.Unmarshal(r.data, &item); err != nil {
+			// the last record of the segment may be partially written if the process was killed
+			log.Error().Err(err).Str("source", w.source).Msg("skip broken wal record")
+			if err = w.wal.release(map[uint64]int{r.segment: 1}); err != nil {
+				return fmt.Errorf("release broken wal record: %w", err)
+			}
+
+			continue
+		}
+
+		w.stateLock.Lock()
+		w.pending[w.adapter.GetCategoryID(item)]++
+		w.stateLock.Unlock()
+
+		w.uncommitted.Add(1)
+		w.chWg.Add(1)
+		w.ch <- entry[T]{item: item, segment: r.segment}
+	}
+
+	return nil
+}
+
+func (w *ClickhouseWorker[T]) batchSizeLimit() uint {
+	if w.adaptive == nil {
+		return w.maxBatchSize
+	}
+
+	size, _ := w.adaptive.current()
+
+	return size
+}
+
+func (w *ClickhouseWorker[T]) countInbound(count int) {
+	if w.adaptive != nil {
+		w.adaptive.addInbound(count)
+	}
+}
+
+// adapt updates the batch limits by the latency of the finished commit
+func (w *ClickhouseWorker[T]) adapt(latency time.Duration) {
+	if w.adaptive == nil {
+		return
+	}
+
+	_, prevDuration := w.adaptive.current()
+	size, duration := w.adaptive.observe(latency)
+	if duration != prevDuration {
+		// the ticker is owned by the worker loop, the stale interval is replaced by the latest one
+		select {
+		case <-w.intervals:
+		default:
+		}
+		select {
+		case w.intervals <- duration:
+		default:
+		}
+	}
+
+	w.observeBatchLimits(size, duration)
+}
+
+func (w *ClickhouseWorker[T]) observeBatchLimits(size uint, duration time.Duration) {
+	batchSizeGauge.WithLabelValues(w.source).Set(float64(size))
+	batchDurationGauge.WithLabelValues(w.source).Set(duration.Seconds())
+}
+
+// MaxBatchDuration returns the longest time the batch is filled before the commit
+func (w *ClickhouseWorker[T]) MaxBatchDuration() time.Duration {
+	return w.maxBatchDuration
+}
+
+// MaxBatchSize returns the largest number of items in the batch
+func (w *ClickhouseWorker[T]) MaxBatchSize() uint {
+	return w.maxBatchSize
+}
+
+// InsertConcurrency returns how many batches may be committed to the clickhouse at the same time
+func (w *ClickhouseWorker[T]) InsertConcurrency() uint {
+	return w.opts.insertConcurrency
+}
+
+// ChannelCapacity returns how many items may wait in the in-memory queue of the worker
+func (w *ClickhouseWorker[T]) ChannelCapacity() uint {
+	return w.opts.channelCapacity
+}
+
+// MaxRetryDelay returns the total backoff of all retries of the failed batch
+func (w *ClickhouseWorker[T]) MaxRetryDelay() time.Duration {
+	return w.opts.retry.maxDelay()
+}
+
+// MaxReconnectDelay returns how long the degraded worker reconnects within the retry policy. The worker keeps
+// reconnecting after it, so items stored during the longer outage may wait more.
+func (w *ClickhouseWorker[T]) MaxReconnectDelay() time.Duration {
+	return w.opts.retry.maxDelay()
+}
+
 func observe(hist *prometheus.HistogramVec, source string, startTime time.Time) {
 	hist.WithLabelValues(source).Observe(float64(time.Since(startTime) / time.Millisecond))
 }
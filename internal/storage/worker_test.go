@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	Group uint32 `json:"group"`
+	Value string `json:"value"`
+}
+
+type testAdapter struct{}
+
+func (testAdapter) GetInsertQuery() string {
+	return "insert into test (value) values (?)"
+}
+
+func (testAdapter) Values(item testItem) []any {
+	return []any{item.Value}
+}
+
+func (testAdapter) GetCategoryID(item testItem) uint32 {
+	return item.Group
+}
+
+// fakeBackend keeps committed rows in memory, the first failCommits commits return errCommit
+type fakeBackend struct {
+	mu          sync.Mutex
+	failCommits int
+	committed   []string
+	commits     int
+}
+
+var errCommit = errors.New("commit failed")
+
+func (b *fakeBackend) Begin(_ context.Context, _ string) (Batch, error) {
+	return &fakeBatch{backend: b}, nil
+}
+
+func (b *fakeBackend) rows() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.committed...)
+}
+
+type fakeBatch struct {
+	backend *fakeBackend
+	rows    []string
+}
+
+func (b *fakeBatch) Append(values ...any) error {
+	b.rows = append(b.rows, values[0].(string))
+
+	return nil
+}
+
+func (b *fakeBatch) Commit() error {
+	b.backend.mu.Lock()
+	defer b.backend.mu.Unlock()
+
+	b.backend.commits++
+	if b.backend.failCommits > 0 {
+		b.backend.failCommits--
+
+		return errCommit
+	}
+	b.backend.committed = append(b.backend.committed, b.rows...)
+
+	return nil
+}
+
+func (b *fakeBatch) Abort() error {
+	return nil
+}
+
+type fakeSink struct {
+	mu      sync.Mutex
+	err     error
+	letters []DeadLetter
+}
+
+func (s *fakeSink) Write(_ context.Context, dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.letters = append(s.letters, dl)
+
+	return nil
+}
+
+func (s *fakeSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.letters)
+}
+
+func fastRetry(attempts int) Option {
+	return WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+}
+
+// startWorker runs the worker until the test is finished and returns the function stopping it
+func startWorker(t *testing.T, w *ClickhouseWorker[testItem]) func() {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Start(ctx)
+	}()
+	<-w.Ready()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("worker stopped with error: %v", err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+func storeAndWait(t *testing.T, w *ClickhouseWorker[testItem], items ...testItem) error {
+	t.Helper()
+
+	acked := make(chan error, 1)
+	if err := w.StoreWithAck(func(err error) { acked <- err }, items...); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	select {
+	case err := <-acked:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("items weren't acked")
+
+		return nil
+	}
+}
+
+func TestWorkerCommitsFullBatch(t *testing.T) {
+	backend := &fakeBackend{}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 2, time.Hour)
+	startWorker(t, w)
+
+	err := storeAndWait(t, w, testItem{Group: 1, Value: "a"}, testItem{Group: 1, Value: "b"})
+	if err != nil {
+		t.Fatalf("ack error: %v", err)
+	}
+
+	if rows := backend.rows(); len(rows) != 2 || rows[0] != "a" || rows[1] != "b" {
+		t.Fatalf("committed rows: %v", rows)
+	}
+	if w.Uncommitted() != 0 {
+		t.Fatalf("uncommitted: %d", w.Uncommitted())
+	}
+}
+
+func TestWorkerCallbacksReceiveCommittedGroups(t *testing.T) {
+	backend := &fakeBackend{}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 2, time.Hour)
+
+	groups := make(chan map[uint32]GroupState, 1)
+	w.RegisterCallback(func(g map[uint32]GroupState) {
+		groups <- g
+	})
+	startWorker(t, w)
+
+	if err := storeAndWait(t, w, testItem{Group: 1, Value: "a"}, testItem{Group: 2, Value: "b"}); err != nil {
+		t.Fatalf("ack error: %v", err)
+	}
+
+	select {
+	case g := <-groups:
+		if len(g) != 2 || g[1] != Committed || g[2] != Committed {
+			t.Fatalf("groups: %v", g)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback wasn't called")
+	}
+}
+
+func TestWorkerRetriesFailedCommit(t *testing.T) {
+	backend := &fakeBackend{failCommits: 1}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 1, time.Hour, fastRetry(3))
+	startWorker(t, w)
+
+	if err := storeAndWait(t, w, testItem{Group: 1, Value: "a"}); err != nil {
+		t.Fatalf("ack error: %v", err)
+	}
+
+	if rows := backend.rows(); len(rows) != 1 {
+		t.Fatalf("committed rows: %v", rows)
+	}
+}
+
+func TestWorkerDeadLetters(t *testing.T) {
+	for name, tc := range map[string]struct {
+		sinkErr error
+		wantAck bool
+	}{
+		"dead lettered batch is acked":          {wantAck: true},
+		"batch is nacked if dead letter failed": {sinkErr: errors.New("sink failed")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend := &fakeBackend{failCommits: 100}
+			sink := &fakeSink{err: tc.sinkErr}
+			w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 1, time.Hour, fastRetry(2), WithDeadLetterSink(sink))
+			startWorker(t, w)
+
+			err := storeAndWait(t, w, testItem{Group: 1, Value: "a"})
+			if tc.wantAck && err != nil {
+				t.Fatalf("ack error: %v", err)
+			}
+			if !tc.wantAck && err == nil {
+				t.Fatal("batch was acked")
+			}
+
+			if tc.sinkErr == nil && sink.count() != 1 {
+				t.Fatalf("dead letters: %d", sink.count())
+			}
+			if len(backend.rows()) != 0 {
+				t.Fatalf("committed rows: %v", backend.rows())
+			}
+		})
+	}
+}
+
+func TestWorkerRetryIsInterruptedOnShutdown(t *testing.T) {
+	backend := &fakeBackend{failCommits: 100}
+	sink := &fakeSink{}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 10, time.Hour,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}),
+		WithDeadLetterSink(sink),
+	)
+	stop := startWorker(t, w)
+
+	acked := make(chan error, 1)
+	if err := w.StoreWithAck(func(err error) { acked <- err }, testItem{Group: 1, Value: "a"}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown waits for the retry backoff")
+	}
+
+	if err := <-acked; err != nil {
+		t.Fatalf("dead lettered batch is not acked: %v", err)
+	}
+	if sink.count() != 1 {
+		t.Fatalf("dead letters: %d", sink.count())
+	}
+}
+
+func TestWorkerAdaptsByLatencyOfSuccessfulAttempt(t *testing.T) {
+	backend := &fakeBackend{failCommits: 1}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 4, time.Hour,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}),
+		WithAdaptiveBatching(AdaptivePolicy{
+			MinBatchSize:        1,
+			MinBatchDuration:    time.Millisecond,
+			TargetCommitLatency: 50 * time.Millisecond,
+		}),
+	)
+	startWorker(t, w)
+
+	items := []testItem{{Group: 1, Value: "a"}, {Group: 1, Value: "b"}, {Group: 1, Value: "c"}, {Group: 1, Value: "d"}}
+	if err := storeAndWait(t, w, items...); err != nil {
+		t.Fatalf("ack error: %v", err)
+	}
+
+	// the retry backoff exceeds the target latency, the batch is shrunk if it's taken into account
+	if size := w.batchSizeLimit(); size != 4 {
+		t.Fatalf("batch size: %d", size)
+	}
+}
+
+func TestWorkerReplayAcksDeadLetter(t *testing.T) {
+	backend := &fakeBackend{}
+	w := NewClickhouseWorker[testItem]("test", backend, testAdapter{}, 2, time.Hour)
+	startWorker(t, w)
+
+	acked := make(chan error, 1)
+	err := w.Replay(DeadLetter{
+		Source: "test",
+		Items:  []json.RawMessage{[]byte(`{"group":1,"value":"a"}`), []byte(`{"group":2,"value":"b"}`)},
+	}, func(err error) { acked <- err })
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	select {
+	case err = <-acked:
+		if err != nil {
+			t.Fatalf("ack error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead letter wasn't acked")
+	}
+
+	if rows := backend.rows(); len(rows) != 2 {
+		t.Fatalf("committed rows: %v", rows)
+	}
+
+	if err = w.Replay(DeadLetter{Source: "other"}, func(error) {}); err == nil {
+		t.Fatal("dead letter of other source was replayed")
+	}
+}
@@ -3,6 +3,7 @@ package token
 import (
 	"context"
 	"fmt"
+	"time"
 
 	pevents "github.com/goverland-labs/goverland-platform-events/events/core"
 	client "github.com/goverland-labs/goverland-platform-events/pkg/natsclient"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/helpers"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/natsack"
 )
 
 const (
@@ -22,7 +24,13 @@ type closable interface {
 }
 
 type storage interface {
-	Store(group uint32, items ...*pevents.TokenPricePayload) error
+	StoreWithAck(ack func(error), items ...*pevents.TokenPricePayload) error
+	MaxBatchSize() uint
+	MaxBatchDuration() time.Duration
+	InsertConcurrency() uint
+	ChannelCapacity() uint
+	MaxRetryDelay() time.Duration
+	MaxReconnectDelay() time.Duration
 }
 
 type Consumer struct {
@@ -39,28 +47,31 @@ func NewConsumer(nc *nats.Conn, st storage) *Consumer {
 	}
 }
 
-func (c *Consumer) handler() pevents.TokenPricesHandler {
-	return func(payload pevents.TokenPricesPayload) error {
-		var err error
-
-		for _, t := range payload {
-			err = c.storage.Store(t.DaoID.ID(), helpers.Ptr(t))
+func (c *Consumer) handler() natsack.Handler[pevents.TokenPricesPayload] {
+	return func(payload pevents.TokenPricesPayload, _ natsack.Meta, ack natsack.Ack) error {
+		prices := make([]*pevents.TokenPricePayload, len(payload))
+		for i := range payload {
+			prices[i] = helpers.Ptr(payload[i])
+		}
 
-			if err != nil {
-				return err
-			}
+		err := c.storage.StoreWithAck(ack, prices...)
+		if err != nil {
+			return err
 		}
 
 		log.Debug().Int("count", len(payload)).Msg("tokens were processed")
 
-		return err
+		return nil
 	}
 }
 
 func (c *Consumer) Start(ctx context.Context) error {
 	group := config.GenerateGroupName(groupName)
 
-	consumer, err := client.NewConsumer(ctx, c.conn, group, pevents.DaoTokenPriceUpdated, c.handler(), client.WithMaxAckPending(10))
+	consumer, err := natsack.NewConsumer(ctx, c.conn, group, pevents.DaoTokenPriceUpdated, c.handler(),
+		client.WithMaxAckPending(config.MaxAckPending(c.storage.MaxBatchSize(), c.storage.InsertConcurrency(), c.storage.ChannelCapacity())),
+		client.WithAckWait(config.AckWait(c.storage.MaxBatchDuration(), c.storage.MaxRetryDelay(), c.storage.MaxReconnectDelay())),
+	)
 	if err != nil {
 		return fmt.Errorf("consume for %s/%s: %w", group, pevents.DaoTokenPriceUpdated, err)
 	}
@@ -73,6 +84,16 @@ func (c *Consumer) Start(ctx context.Context) error {
 	return c.stop()
 }
 
+// Backfill re-reads the consumer subject from the start position by the ephemeral consumer and stores
+// events by the same handler. It returns when all events existing at the moment of the call are committed.
+func (c *Consumer) Backfill(ctx context.Context, opts natsack.ReplayOpts) error {
+	if err := natsack.Replay(ctx, c.conn, pevents.DaoTokenPriceUpdated, c.handler(), opts); err != nil {
+		return fmt.Errorf("backfill %s: %w", pevents.DaoTokenPriceUpdated, err)
+	}
+
+	return nil
+}
+
 func (c *Consumer) stop() error {
 	for _, cs := range c.consumers {
 		if err := cs.Close(); err != nil {
@@ -1,6 +1,7 @@
 package vote
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/goverland-labs/goverland-platform-events/events/core"
@@ -12,7 +13,7 @@ type ClickhouseAdapter struct {
 }
 
 func (c ClickhouseAdapter) GetInsertQuery() string {
-	return "INSERT INTO votes_raw (dao_id, proposal_id, created_at, voter, app, choice, vp, vp_by_strategy, vp_state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return "INSERT INTO votes_raw (dao_id, proposal_id, created_at, voter, app, choice, vp, vp_by_strategy, vp_state, event_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 }
 
 func (c ClickhouseAdapter) Values(v *core.VotePayload) []any {
@@ -28,9 +29,15 @@ func (c ClickhouseAdapter) Values(v *core.VotePayload) []any {
 		v.Vp,
 		v.VpByStrategy,
 		v.VpState,
+		EventID(v),
 	}
 }
 
+// EventID returns the idempotency key of the vote, redelivered votes have the same key
+func EventID(v *core.VotePayload) string {
+	return helpers.EventID(v.DaoID.String(), v.ProposalID, v.Voter, strconv.Itoa(v.Created))
+}
+
 func (c ClickhouseAdapter) GetCategoryID(v *core.VotePayload) uint32 {
 	return v.DaoID.ID()
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/metrics"
 	"github.com/goverland-labs/goverland-core-analytics-service/pkg/helpers"
+	"github.com/goverland-labs/goverland-core-analytics-service/pkg/natsack"
 )
 
 const (
@@ -24,7 +25,13 @@ type closable interface {
 }
 
 type storage interface {
-	Store(group uint32, items ...*pevents.VotePayload) error
+	StoreWithAck(ack func(error), items ...*pevents.VotePayload) error
+	MaxBatchSize() uint
+	MaxBatchDuration() time.Duration
+	InsertConcurrency() uint
+	ChannelCapacity() uint
+	MaxRetryDelay() time.Duration
+	MaxReconnectDelay() time.Duration
 }
 
 type Consumer struct {
@@ -41,8 +48,8 @@ func NewConsumer(nc *nats.Conn, st storage) *Consumer {
 	}
 }
 
-func (c *Consumer) handler() pevents.VotesHandler {
-	return func(payload pevents.VotesPayload) error {
+func (c *Consumer) handler() natsack.Handler[pevents.VotesPayload] {
+	return func(payload pevents.VotesPayload, _ natsack.Meta, ack natsack.Ack) error {
 		var err error
 		defer func(start time.Time) {
 			metricHandleHistogram.
@@ -50,24 +57,30 @@ func (c *Consumer) handler() pevents.VotesHandler {
 				Observe(time.Since(start).Seconds())
 		}(time.Now())
 
-		for _, v := range payload {
-			err = c.storage.Store(v.DaoID.ID(), helpers.Ptr(v))
+		votes := make([]*pevents.VotePayload, len(payload))
+		for i := range payload {
+			votes[i] = helpers.Ptr(payload[i])
+		}
 
-			if err != nil {
-				return err
-			}
+		// the message is acked only after the votes are committed to the clickhouse
+		err = c.storage.StoreWithAck(ack, votes...)
+		if err != nil {
+			return err
 		}
 
 		log.Debug().Int("count", len(payload)).Msg("votes were processed")
 
-		return err
+		return nil
 	}
 }
 
 func (c *Consumer) Start(ctx context.Context) error {
 	group := config.GenerateGroupName(groupName)
 
-	consumer, err := client.NewConsumer(ctx, c.conn, group, pevents.SubjectVoteCreated, c.handler(), client.WithMaxAckPending(10))
+	consumer, err := natsack.NewConsumer(ctx, c.conn, group, pevents.SubjectVoteCreated, c.handler(),
+		client.WithMaxAckPending(config.MaxAckPending(c.storage.MaxBatchSize(), c.storage.InsertConcurrency(), c.storage.ChannelCapacity())),
+		client.WithAckWait(config.AckWait(c.storage.MaxBatchDuration(), c.storage.MaxRetryDelay(), c.storage.MaxReconnectDelay())),
+	)
 	if err != nil {
 		return fmt.Errorf("consume for %s/%s: %w", group, pevents.SubjectVoteCreated, err)
 	}
@@ -76,11 +89,20 @@ func (c *Consumer) Start(ctx context.Context) error {
 
 	log.Info().Msg("votes consumer is started")
 
-	// todo: handle correct stopping the consumer by context
 	<-ctx.Done()
 	return c.stop()
 }
 
+// Backfill re-reads the consumer subject from the start position by the ephemeral consumer and stores
+// events by the same handler. It returns when all events existing at the moment of the call are committed.
+func (c *Consumer) Backfill(ctx context.Context, opts natsack.ReplayOpts) error {
+	if err := natsack.Replay(ctx, c.conn, pevents.SubjectVoteCreated, c.handler(), opts); err != nil {
+		return fmt.Errorf("backfill %s: %w", pevents.SubjectVoteCreated, err)
+	}
+
+	return nil
+}
+
 func (c *Consumer) stop() error {
 	for _, cs := range c.consumers {
 		if err := cs.Close(); err != nil {
@@ -1,17 +1,29 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/caarlos0/env/v6"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/s-larionov/process-manager"
 	"github.com/shopspring/decimal"
 
 	"github.com/goverland-labs/goverland-core-analytics-service/internal"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/config"
 	"github.com/goverland-labs/goverland-core-analytics-service/internal/logger"
+	"github.com/goverland-labs/goverland-core-analytics-service/internal/migration"
 )
 
-const decimalDivisionPrecision = 32
+const (
+	decimalDivisionPrecision = 32
+	backfillCommand          = "backfill"
+)
 
 var (
 	cfg config.App
@@ -19,6 +31,7 @@ var (
 
 func init() {
 	decimal.DivisionPrecision = decimalDivisionPrecision
+	cfg.Storage = config.DefaultStorage()
 	err := env.Parse(&cfg)
 	if err != nil {
 		panic(err)
@@ -33,6 +46,24 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == backfillCommand {
+		if err := backfill(os.Args[2:]); err != nil {
+			log.Error().Err(err).Msg("backfill failed")
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == migration.PrepareDedupCommand {
+		if err := internal.RunPrepareDedup(cfg); err != nil {
+			log.Error().Err(err).Msg("prepare dedup failed")
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	app, err := internal.NewApplication(cfg)
 	if err != nil {
 		panic(err)
@@ -40,3 +71,38 @@ func main() {
 
 	app.Run()
 }
+
+func backfill(args []string) error {
+	var (
+		opts      internal.BackfillOptions
+		startTime string
+	)
+
+	fs := flag.NewFlagSet(backfillCommand, flag.ExitOnError)
+	fs.StringVar(&opts.Source, "source", "", fmt.Sprintf("source to backfill: %s", strings.Join(internal.BackfillSources, ", ")))
+	fs.Uint64Var(&opts.StartSequence, "start-seq", 0, "stream sequence to start from, applied to each stream of the source")
+	fs.StringVar(&startTime, "start-time", "", "time to start from in RFC3339 format")
+	fs.DurationVar(&opts.FlushInterval, "flush-interval", 5*time.Second, "max batch duration of the storage worker")
+	fs.StringVar(&opts.DeadLetters, "dead-letters", "", "dead letter file to replay instead of the stream")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !slices.Contains(internal.BackfillSources, opts.Source) {
+		return fmt.Errorf("unknown source %q, expected one of: %s", opts.Source, strings.Join(internal.BackfillSources, ", "))
+	}
+
+	if startTime != "" {
+		if opts.StartSequence > 0 {
+			return fmt.Errorf("start-seq and start-time are mutually exclusive")
+		}
+
+		t, err := time.Parse(time.RFC3339, startTime)
+		if err != nil {
+			return fmt.Errorf("parse start-time: %w", err)
+		}
+		opts.StartTime = t
+	}
+
+	return internal.RunBackfill(cfg, opts)
+}
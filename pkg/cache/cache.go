@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const cleanupInterval = time.Minute
+
+// errLoadPanicked is returned to callers waiting for the load which panicked
+var errLoadPanicked = errors.New("cache load panicked")
+
+// Cache is an in-memory cache of the process with expiration and invalidation by tags. Concurrent loads of the same
+// key are de-duplicated: the load function is called once and all callers get its result. The least recently used
+// entries are evicted above the max number of entries.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*entry
+	// lru keeps keys of entries, the most recently used first
+	lru   *list.List
+	calls map[string]*call
+	// generations of tags are increased on invalidation, so results loaded before it aren't stored
+	generations map[string]uint64
+}
+
+type entry struct {
+	value     any
+	expiresAt time.Time
+	tags      []string
+	gens      []uint64
+	element   *list.Element
+}
+
+type call struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// New creates the cache keeping at most maxEntries entries, 0 means the number isn't limited
+func New(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*entry),
+		lru:         list.New(),
+		calls:       make(map[string]*call),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Load returns the cached value of the key or loads it. Errors aren't cached. The load is called with the context
+// of the caller which started it, other callers wait for it until their own contexts are done and load again
+// if it was cancelled.
+func Load[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, tags []string, load func(ctx context.Context) (T, error)) (T, error) {
+	value, err := c.do(ctx, key, ttl, tags, func(ctx context.Context) (any, error) {
+		return load(ctx)
+	})
+	if err != nil || value == nil {
+		var empty T
+
+		return empty, err
+	}
+
+	return value.(T), nil
+}
+
+func (c *Cache) do(ctx context.Context, key string, ttl time.Duration, tags []string, load func(ctx context.Context) (any, error)) (any, error) {
+	for {
+		c.mu.Lock()
+		if e, ok := c.entries[key]; ok && c.validUnsafe(e) {
+			c.lru.MoveToFront(e.element)
+			c.mu.Unlock()
+
+			return e.value, nil
+		}
+
+		cl, ok := c.calls[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cl.done:
+		}
+
+		if ctx.Err() == nil && (errors.Is(cl.err, context.Canceled) || errors.Is(cl.err, context.DeadlineExceeded)) {
+			continue
+		}
+
+		return cl.value, cl.err
+	}
+
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	gens := c.generationsUnsafe(tags)
+	c.mu.Unlock()
+
+	// the call is completed by the defer, so waiters aren't blocked and the key is loaded again if the load panics
+	completed := false
+	defer func() {
+		if !completed {
+			cl.err = errLoadPanicked
+		}
+
+		c.mu.Lock()
+		delete(c.calls, key)
+		if cl.err == nil && ttl > 0 {
+			c.storeUnsafe(key, &entry{
+				value:     cl.value,
+				expiresAt: time.Now().Add(ttl),
+				tags:      tags,
+				gens:      gens,
+			})
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	cl.value, cl.err = load(ctx)
+	completed = true
+
+	return cl.value, cl.err
+}
+
+func (c *Cache) storeUnsafe(key string, e *entry) {
+	if old, ok := c.entries[key]; ok {
+		c.removeUnsafe(key, old)
+	}
+
+	e.element = c.lru.PushFront(key)
+	c.entries[key] = e
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back().Value.(string)
+		c.removeUnsafe(oldest, c.entries[oldest])
+	}
+}
+
+func (c *Cache) removeUnsafe(key string, e *entry) {
+	c.lru.Remove(e.element)
+	delete(c.entries, key)
+}
+
+// Invalidate drops entries with any of the tags, including the ones being loaded now
+func (c *Cache) Invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		c.generations[tag]++
+	}
+}
+
+func (c *Cache) generationsUnsafe(tags []string) []uint64 {
+	gens := make([]uint64, len(tags))
+	for i, tag := range tags {
+		gens[i] = c.generations[tag]
+	}
+
+	return gens
+}
+
+func (c *Cache) validUnsafe(e *entry) bool {
+	if time.Now().After(e.expiresAt) {
+		return false
+	}
+
+	for i, tag := range e.tags {
+		if c.generations[tag] != e.gens[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Process removes expired and invalidated entries periodically
+func (c *Cache) Process(ctx context.Context) error {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.mu.Lock()
+			for key, e := range c.entries {
+				if !c.validUnsafe(e) {
+					c.removeUnsafe(key, e)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
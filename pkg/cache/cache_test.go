@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter is the load function which returns the number of its calls
+type counter struct {
+	calls atomic.Int32
+}
+
+func (c *counter) load(context.Context) (int, error) {
+	return int(c.calls.Add(1)), nil
+}
+
+func TestLoad(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ttl        time.Duration
+		invalidate []string
+		wait       time.Duration
+		want       int
+	}{
+		"cached value is returned":              {ttl: time.Hour, want: 1},
+		"zero ttl isn't cached":                 {ttl: 0, want: 2},
+		"expired value is loaded again":         {ttl: time.Millisecond, wait: 5 * time.Millisecond, want: 2},
+		"invalidated value is loaded again":     {ttl: time.Hour, invalidate: []string{"dao:1"}, want: 2},
+		"other tags don't invalidate the value": {ttl: time.Hour, invalidate: []string{"dao:2"}, want: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := New(0)
+			cnt := &counter{}
+			tags := []string{"dao:1"}
+
+			if _, err := Load(context.Background(), c, "key", tc.ttl, tags, cnt.load); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			time.Sleep(tc.wait)
+			c.Invalidate(tc.invalidate...)
+
+			got, err := Load(context.Background(), c, "key", tc.ttl, tags, cnt.load)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("value: got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadDoesNotCacheErrors(t *testing.T) {
+	c := New(0)
+	errLoad := errors.New("load failed")
+
+	_, err := Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+		return 0, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("load error: %v", err)
+	}
+
+	got, err := Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+		return 1, nil
+	})
+	if err != nil || got != 1 {
+		t.Fatalf("load after error: %d, %v", got, err)
+	}
+}
+
+func TestLoadDeduplicatesConcurrentCalls(t *testing.T) {
+	c := New(0)
+	cnt := &counter{}
+	release := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		<-release
+
+		return cnt.load(ctx)
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = Load(context.Background(), c, "key", time.Hour, nil, load)
+		}(i)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls := cnt.calls.Load(); calls != 1 {
+		t.Fatalf("load calls: %d", calls)
+	}
+	for _, r := range results {
+		if r != 1 {
+			t.Fatalf("results: %v", results)
+		}
+	}
+}
+
+func TestInvalidateDuringLoadDropsResult(t *testing.T) {
+	c := New(0)
+	cnt := &counter{}
+	tags := []string{"dao:1"}
+
+	_, err := Load(context.Background(), c, "key", time.Hour, tags, func(ctx context.Context) (int, error) {
+		// the commit happens while the result is being loaded, so the result may not contain it
+		c.Invalidate("dao:1")
+
+		return cnt.load(ctx)
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	got, err := Load(context.Background(), c, "key", time.Hour, tags, cnt.load)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got != 2 {
+		t.Fatalf("result loaded before invalidation was cached: %d", got)
+	}
+}
+
+func TestWaiterLoadsAgainIfLeaderIsCancelled(t *testing.T) {
+	c := New(0)
+	started := make(chan struct{})
+	leaderCtx, cancel := context.WithCancel(context.Background())
+
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := Load(leaderCtx, c, "key", time.Hour, nil, func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+
+			return 0, ctx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan int, 1)
+	go func() {
+		v, _ := Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+			return 42, nil
+		})
+		waiter <- v
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader error: %v", err)
+	}
+	select {
+	case v := <-waiter:
+		if v != 42 {
+			t.Fatalf("waiter value: %d", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter didn't load again")
+	}
+}
+
+func TestWaiterReturnsOnItsContext(t *testing.T) {
+	c := New(0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	go func() {
+		_, _ = Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+			close(started)
+			<-release
+
+			return 1, nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := Load(ctx, c, "key", time.Hour, nil, func(context.Context) (int, error) {
+		return 2, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiter error: %v", err)
+	}
+}
+
+func TestLeastRecentlyUsedEntryIsEvicted(t *testing.T) {
+	c := New(2)
+	cnt := map[string]*counter{"a": {}, "b": {}, "c": {}}
+	load := func(key string) int {
+		v, err := Load(context.Background(), c, key, time.Hour, nil, cnt[key].load)
+		if err != nil {
+			t.Fatalf("load %s: %v", key, err)
+		}
+
+		return v
+	}
+
+	load("a")
+	load("b")
+	// a is used after b, so b is evicted by c
+	load("a")
+	load("c")
+
+	if got := load("a"); got != 1 {
+		t.Fatalf("recently used entry was evicted: %d loads", got)
+	}
+	if got := load("b"); got != 2 {
+		t.Fatalf("least recently used entry wasn't evicted: %d loads", got)
+	}
+}
+
+func TestPanickedLoadIsCleanedUp(t *testing.T) {
+	c := New(0)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic isn't propagated")
+			}
+		}()
+
+		_, _ = Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+			panic("load failed")
+		})
+	}()
+
+	got, err := Load(context.Background(), c, "key", time.Hour, nil, func(context.Context) (int, error) {
+		return 1, nil
+	})
+	if err != nil || got != 1 {
+		t.Fatalf("load after panic: %d, %v", got, err)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"google.golang.org/grpc"
 )
 
-func NewGrpcServer() *grpc.Server {
-	server := grpc.NewServer()
+func NewGrpcServer(opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
 	StdRegister(server)
 
 	return server
@@ -0,0 +1,34 @@
+package grpcsrv
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryTimeout limits handling of unary requests by the timeout of the method, methods are set by names
+// without the service, def is used for other methods. Zero timeout disables the limit, the client deadline
+// is kept if it's earlier.
+func UnaryTimeout(def time.Duration, methods map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		timeout, ok := methods[path.Base(info.FullMethod)]
+		if !ok {
+			timeout = def
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return handler(ctx, req)
+	}
+}
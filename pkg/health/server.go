@@ -28,11 +28,20 @@ func NewHealthCheckServer(listen, path string, handler http.Handler) *http.Serve
 	return server
 }
 
-func DefaultHandler(manager *process.Manager) http.Handler {
+// Check reports whether the component is healthy
+type Check func() bool
+
+// DefaultHandler reports the process manager state and the state of the components from checks.
+// Unhealthy components are only reported in the body: they are expected to recover on their own,
+// so the status code isn't changed to avoid restarting the process.
+func DefaultHandler(manager *process.Manager, checks map[string]Check) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := map[string]interface{}{
 			"process_manager": manager.IsRunning(),
 		}
+		for name, check := range checks {
+			resp[name] = check()
+		}
 
 		body, err := json.Marshal(resp)
 		if err != nil {
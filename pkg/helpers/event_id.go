@@ -0,0 +1,15 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// EventID returns the idempotency key of the event: hex encoded sha256 of the parts joined by "|".
+// The same value can be calculated in clickhouse by lower(hex(SHA256(concat(part1, '|', part2, ...)))).
+func EventID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+
+	return hex.EncodeToString(sum[:])
+}
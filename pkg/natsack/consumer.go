@@ -0,0 +1,257 @@
+package natsack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	client "github.com/goverland-labs/goverland-platform-events/pkg/natsclient"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	consumerActionAck  = "ack"
+	consumerActionNack = "nack"
+
+	nakDelay = 5 * time.Second
+
+	drainCheckInterval = 50 * time.Millisecond
+)
+
+var ErrGroupRequired = errors.New("group is required")
+
+// Ack finishes the message processing: the message is acked on nil error and nacked with delay otherwise.
+// Only the first call is taken into account.
+type Ack func(err error)
+
+// Meta describes the stream message of the payload. Timestamp is the time the message was stored in the stream,
+// it is kept on redeliveries and replays, so it can be used as the event time.
+type Meta struct {
+	Sequence  uint64
+	Timestamp time.Time
+}
+
+// Handler receives the decoded payload and must call ack once the payload is persisted.
+// If the handler returns an error, the message is nacked immediately.
+type Handler[T any] func(payload T, meta Meta, ack Ack) error
+
+// Consumer is a queue subscriber with deferred acknowledgement. Unlike natsclient.Consumer, the message
+// isn't acked when the handler returns, but when the handler calls ack, so the handler isn't blocked while
+// the payload is waiting for the storage commit.
+// Stream and consumer names are the same as in natsclient, so existing durable consumers are reused.
+//
+// The application stops consumers before storage workers, so handlers of delivered messages are drained
+// while the storage still accepts items.
+type Consumer struct {
+	sub          *nats.Subscription
+	group        string
+	subject      string
+	drainTimeout time.Duration
+}
+
+func NewConsumer[T any](ctx context.Context, conn *nats.Conn, group, subject string, h Handler[T], opts ...client.ConsumerOpt) (*Consumer, error) {
+	if group == "" {
+		return nil, ErrGroupRequired
+	}
+
+	if subject == "" {
+		return nil, client.ErrSubjectRequired
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := getOrCreateStream(js, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerName := buildConsumerName(group, subject)
+	cfg := &nats.ConsumerConfig{
+		Durable:        consumerName,
+		Name:           consumerName,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		DeliverSubject: fmt.Sprintf("deliver.%s", consumerName),
+		DeliverGroup:   group,
+		FilterSubject:  subject,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if err = createOrUpdateConsumer(js, stream.Config.Name, cfg); err != nil {
+		return nil, fmt.Errorf("consumer '%s': %w", group, err)
+	}
+
+	subOpts := []nats.SubOpt{
+		nats.Durable(consumerName),
+		nats.ManualAck(),
+		nats.DeliverAll(),
+		nats.Context(ctx),
+		nats.MaxDeliver(cfg.MaxDeliver),
+		nats.AckWait(cfg.AckWait),
+	}
+
+	if cfg.MaxAckPending > 0 {
+		subOpts = append(subOpts, nats.MaxAckPending(cfg.MaxAckPending))
+	}
+
+	subscription, err := js.QueueSubscribe(subject, group, func(msg *nats.Msg) {
+		start := time.Now()
+
+		var once sync.Once
+		ack := func(err error) {
+			once.Do(func() {
+				finish(msg, group, subject, start, err)
+			})
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			ack(err)
+
+			return
+		}
+
+		var payload T
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			ack(err)
+
+			return
+		}
+
+		if err := h(payload, newMeta(meta), ack); err != nil {
+			ack(err)
+		}
+	}, subOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("queue subscribe: %w", err)
+	}
+
+	drainTimeout := conn.Opts.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = nats.DefaultDrainTimeout
+	}
+
+	return &Consumer{
+		sub:          subscription,
+		group:        group,
+		subject:      subject,
+		drainTimeout: drainTimeout,
+	}, nil
+}
+
+// Close stops receiving new messages and waits until the handlers of already delivered messages return.
+// Acks of these messages are still sent after Close, so the connection must be kept open until the storage
+// is flushed. The connection drain timeout limits the waiting.
+func (c *Consumer) Close() error {
+	if err := c.sub.Drain(); err != nil {
+		return fmt.Errorf("drain [%s/%s]: %w", c.subject, c.group, err)
+	}
+
+	timeout := time.NewTimer(c.drainTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for c.sub.IsValid() {
+		select {
+		case <-timeout.C:
+			return fmt.Errorf("drain [%s/%s]: %w", c.subject, c.group, nats.ErrDrainTimeout)
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+func newMeta(meta *nats.MsgMetadata) Meta {
+	return Meta{
+		Sequence:  meta.Sequence.Stream,
+		Timestamp: meta.Timestamp,
+	}
+}
+
+func finish(msg *nats.Msg, group, subject string, start time.Time, err error) {
+	action := consumerActionAck
+	defer func() {
+		client.CollectConsumerMetric(subject, action, err, time.Since(start).Seconds())
+	}()
+
+	if err != nil {
+		action = consumerActionNack
+		if nakErr := msg.NakWithDelay(nakDelay); nakErr != nil {
+			log.Error().Err(fmt.Errorf("[%s/%s] nack err: %w", group, subject, nakErr)).Msg("nack message")
+		}
+
+		return
+	}
+
+	if ackErr := msg.Ack(); ackErr != nil {
+		log.Error().Err(fmt.Errorf("[%s/%s] ack err: %w", group, subject, ackErr)).Msg("ack message")
+	}
+}
+
+func createOrUpdateConsumer(js nats.JetStreamContext, stream string, cfg *nats.ConsumerConfig) error {
+	info, err := js.ConsumerInfo(stream, cfg.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(stream, cfg)
+
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// ack settings depend on the storage batching, so they have to follow the service configuration
+	if info.Config.AckWait == cfg.AckWait && info.Config.MaxAckPending == cfg.MaxAckPending {
+		return nil
+	}
+
+	_, err = js.UpdateConsumer(stream, cfg)
+
+	return err
+}
+
+func getOrCreateStream(js nats.JetStreamContext, subject string) (*nats.StreamInfo, error) {
+	streamName := buildStreamName(subject)
+	s, err := js.StreamInfo(streamName)
+	if err == nil {
+		return s, nil
+	}
+
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return nil, fmt.Errorf("get stream info [%s]: %v", streamName, err)
+	}
+
+	s, err = js.AddStream(&nats.StreamConfig{
+		Name:      streamName,
+		Subjects:  []string{subject},
+		Retention: nats.LimitsPolicy,
+		Discard:   nats.DiscardOld,
+		Storage:   nats.FileStorage,
+		MaxAge:    client.StreamDefaultMaxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("add stream: %w", err)
+	}
+
+	return s, nil
+}
+
+func buildStreamName(subject string) string {
+	return strings.Replace(fmt.Sprintf("str_%s", subject), ".", "_", -1)
+}
+
+func buildConsumerName(group, subject string) string {
+	return strings.Replace(fmt.Sprintf("consumer_%s_%s", group, subject), ".", "_", -1)
+}
@@ -0,0 +1,252 @@
+package natsack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+const testSubject = "test.events"
+
+type testPayload struct {
+	ID int `json:"id"`
+}
+
+// runServer starts the embedded nats server with jetstream and returns the connection to it
+func runServer(t *testing.T) *nats.Conn {
+	t.Helper()
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+func publish(t *testing.T, conn *nats.Conn, ids ...int) {
+	t.Helper()
+
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	if _, err = getOrCreateStream(js, testSubject); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	for _, id := range ids {
+		if _, err = js.Publish(testSubject, []byte(fmt.Sprintf(`{"id":%d}`, id))); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+}
+
+// collector acks payloads asynchronously like the storage worker does after the commit
+type collector struct {
+	mu  sync.Mutex
+	ids []int
+	err error
+}
+
+func (c *collector) handler(payload testPayload, _ Meta, ack Ack) error {
+	go func() {
+		time.Sleep(time.Millisecond)
+
+		c.mu.Lock()
+		c.ids = append(c.ids, payload.ID)
+		err := c.err
+		c.mu.Unlock()
+
+		ack(err)
+	}()
+
+	return nil
+}
+
+func (c *collector) received() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := append([]int(nil), c.ids...)
+	sort.Ints(res)
+
+	return res
+}
+
+func TestReplay(t *testing.T) {
+	conn := runServer(t)
+	publish(t, conn, 1, 2, 3, 4, 5)
+
+	for name, tc := range map[string]struct {
+		opts ReplayOpts
+		want []int
+	}{
+		"whole stream":          {want: []int{1, 2, 3, 4, 5}},
+		"from sequence":         {opts: ReplayOpts{StartSequence: 4}, want: []int{4, 5}},
+		"sequence after stream": {opts: ReplayOpts{StartSequence: 10}},
+		"time after stream":     {opts: ReplayOpts{StartTime: time.Now().Add(time.Hour)}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := &collector{}
+			if err := Replay(context.Background(), conn, testSubject, c.handler, tc.opts); err != nil {
+				t.Fatalf("replay: %v", err)
+			}
+
+			// all payloads are acked when replay returns
+			got := c.received()
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("received: %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplayReturnsHandlingError(t *testing.T) {
+	conn := runServer(t)
+	publish(t, conn, 1, 2)
+
+	errStore := errors.New("store failed")
+	c := &collector{err: errStore}
+	err := Replay(context.Background(), conn, testSubject, c.handler, ReplayOpts{})
+	if !errors.Is(err, errStore) {
+		t.Fatalf("replay error: %v", err)
+	}
+	if got := c.received(); len(got) != 2 {
+		t.Fatalf("received: %v", got)
+	}
+}
+
+func TestReplayMissingStream(t *testing.T) {
+	conn := runServer(t)
+
+	c := &collector{}
+	if err := Replay(context.Background(), conn, testSubject, c.handler, ReplayOpts{}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+}
+
+func TestConsumerAcksAfterHandlerAck(t *testing.T) {
+	conn := runServer(t)
+	publish(t, conn, 1, 2, 3)
+
+	acks := make(chan Ack, 3)
+	consumer, err := NewConsumer(context.Background(), conn, "group", testSubject, func(_ testPayload, _ Meta, ack Ack) error {
+		acks <- ack
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("consumer: %v", err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	stream, consumerName := buildStreamName(testSubject), buildConsumerName("group", testSubject)
+
+	pending := make([]Ack, 0, 3)
+	for len(pending) < 3 {
+		select {
+		case ack := <-acks:
+			pending = append(pending, ack)
+		case <-time.After(5 * time.Second):
+			t.Fatal("messages weren't delivered")
+		}
+	}
+
+	info, err := js.ConsumerInfo(stream, consumerName)
+	if err != nil {
+		t.Fatalf("consumer info: %v", err)
+	}
+	if info.NumAckPending != 3 {
+		t.Fatalf("ack pending before ack: %d", info.NumAckPending)
+	}
+
+	for _, ack := range pending {
+		ack(nil)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err = js.ConsumerInfo(stream, consumerName)
+		if err != nil {
+			t.Fatalf("consumer info: %v", err)
+		}
+		if info.NumAckPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ack pending after ack: %d", info.NumAckPending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = consumer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestConsumerCloseIsLimitedByDrainTimeout(t *testing.T) {
+	srvConn := runServer(t)
+	publish(t, srvConn, 1)
+
+	conn, err := nats.Connect(srvConn.ConnectedUrl(), nats.DrainTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	consumer, err := NewConsumer(context.Background(), conn, "group", testSubject, func(_ testPayload, _ Meta, ack Ack) error {
+		close(handling)
+		<-release
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("consumer: %v", err)
+	}
+
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message wasn't delivered")
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- consumer.Close()
+	}()
+
+	select {
+	case err = <-closed:
+		// the subscription is removed by the client on the drain timeout or by Close itself
+		if err != nil && !errors.Is(err, nats.ErrDrainTimeout) {
+			t.Fatalf("close error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waits for the blocked handler")
+	}
+}
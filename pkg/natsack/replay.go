@@ -0,0 +1,126 @@
+package natsack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ReplayOpts sets where the replay starts. If neither sequence nor time is set, the whole stream is replayed.
+type ReplayOpts struct {
+	StartSequence uint64
+	StartTime     time.Time
+	// Progress is called after each dispatched message with the stream sequence of the message and the last
+	// sequence of the stream at the moment the replay started
+	Progress func(subject string, sequence, lastSequence uint64)
+}
+
+// Replay reads the subject stream from the start position up to the last message existing at the moment
+// of the call by the ephemeral ordered consumer, passes messages to the handler and waits until all of them
+// are acked. It returns the first handling error.
+func Replay[T any](ctx context.Context, conn *nats.Conn, subject string, h Handler[T], opts ReplayOpts) error {
+	js, err := conn.JetStream()
+	if err != nil {
+		return err
+	}
+
+	streamName := buildStreamName(subject)
+	info, err := js.StreamInfo(streamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get stream info [%s]: %w", streamName, err)
+	}
+
+	lastSeq := info.State.LastSeq
+	if lastSeq == 0 || opts.StartSequence > lastSeq || (!opts.StartTime.IsZero() && opts.StartTime.After(info.State.LastTime)) {
+		return nil
+	}
+
+	subOpts := []nats.SubOpt{
+		nats.OrderedConsumer(),
+		nats.BindStream(streamName),
+	}
+	switch {
+	case opts.StartSequence > 0:
+		subOpts = append(subOpts, nats.StartSequence(opts.StartSequence))
+	case !opts.StartTime.IsZero():
+		subOpts = append(subOpts, nats.StartTime(opts.StartTime))
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	sub, err := js.SubscribeSync(subject, subOpts...)
+	if err != nil {
+		return fmt.Errorf("subscribe [%s]: %w", subject, err)
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+		})
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			fail(fmt.Errorf("next message [%s]: %w", subject, err))
+
+			break
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			fail(fmt.Errorf("message metadata [%s]: %w", subject, err))
+
+			break
+		}
+
+		var payload T
+		if err = json.Unmarshal(msg.Data, &payload); err != nil {
+			fail(fmt.Errorf("unmarshal message #%d [%s]: %w", meta.Sequence.Stream, subject, err))
+		} else {
+			wg.Add(1)
+
+			var once sync.Once
+			ack := func(err error) {
+				once.Do(func() {
+					if err != nil {
+						fail(fmt.Errorf("handle message #%d [%s]: %w", meta.Sequence.Stream, subject, err))
+					}
+					wg.Done()
+				})
+			}
+
+			if err = h(payload, newMeta(meta), ack); err != nil {
+				ack(err)
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(subject, meta.Sequence.Stream, lastSeq)
+		}
+
+		if meta.Sequence.Stream >= lastSeq {
+			break
+		}
+	}
+
+	wg.Wait()
+
+	return firstErr
+}